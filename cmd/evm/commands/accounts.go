@@ -0,0 +1,319 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	passwordFile    string
+	newPasswordFile string
+)
+
+//NewAccountsCmd returns the command group that manages the keys of the
+//keystore (--eth.keystore)
+func NewAccountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "accounts",
+		Short: "Manage the accounts of the keystore",
+	}
+
+	cmd.AddCommand(
+		NewAccountsNewCmd(),
+		NewAccountsListCmd(),
+		NewAccountsImportCmd(),
+		NewAccountsExportCmd(),
+		NewAccountsUpdateCmd())
+
+	return cmd
+}
+
+//AddPasswordFlags adds the flags giving the passphrase of an existing key
+func AddPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&passwordFile, "password-file", "", "File whose first line is the passphrase of the key (prompted if not set)")
+}
+
+//AddNewPasswordFlags adds the flags giving the passphrase a key is encrypted
+//with
+func AddNewPasswordFlags(cmd *cobra.Command, usage string) {
+	cmd.Flags().StringVar(&newPasswordFile, "new-password-file", "", usage)
+}
+
+//NewAccountsNewCmd returns the command that creates a key
+func NewAccountsNewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "new",
+		Short: "Create a new key in the keystore",
+		Args:  cobra.NoArgs,
+		RunE:  accountsNew,
+	}
+
+	AddNewPasswordFlags(cmd, "File whose first line is the passphrase of the new key (prompted if not set)")
+	return cmd
+}
+
+//NewAccountsListCmd returns the command that lists the keys
+func NewAccountsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the addresses of the keystore",
+		Args:  cobra.NoArgs,
+		RunE:  accountsList,
+	}
+}
+
+//NewAccountsImportCmd returns the command that imports a key
+func NewAccountsImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a JSON keyfile, or a file containing a hex encoded private key",
+		Args:  cobra.ExactArgs(1),
+		RunE:  accountsImport,
+	}
+
+	AddPasswordFlags(cmd)
+	AddNewPasswordFlags(cmd, "File whose first line is the passphrase of the imported key (the keyfile's passphrase if not set, prompted for a raw key)")
+	return cmd
+}
+
+//NewAccountsExportCmd returns the command that exports a key
+func NewAccountsExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <address> <file>",
+		Short: "Export a key of the keystore to an encrypted JSON keyfile",
+		Args:  cobra.ExactArgs(2),
+		RunE:  accountsExport,
+	}
+
+	AddPasswordFlags(cmd)
+	AddNewPasswordFlags(cmd, "File whose first line is the passphrase of the exported keyfile (the key's passphrase if not set)")
+	return cmd
+}
+
+//NewAccountsUpdateCmd returns the command that changes the passphrase of a key
+func NewAccountsUpdateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update <address>",
+		Short: "Change the passphrase of a key of the keystore",
+		Args:  cobra.ExactArgs(1),
+		RunE:  accountsUpdate,
+	}
+
+	AddPasswordFlags(cmd)
+	AddNewPasswordFlags(cmd, "File whose first line is the new passphrase (prompted if not set)")
+	return cmd
+}
+
+func accountsNew(cmd *cobra.Command, args []string) error {
+	ks, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(newPasswordFile, "Passphrase of the new key", true)
+	if err != nil {
+		return err
+	}
+
+	account, err := ks.NewAccount(passphrase)
+	if err != nil {
+		return fmt.Errorf("error creating key: %s", err)
+	}
+
+	fmt.Printf("Address: %s\n", account.Address.Hex())
+	fmt.Printf("Keyfile: %s\n", account.URL.Path)
+	return nil
+}
+
+func accountsList(cmd *cobra.Command, args []string) error {
+	ks, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+
+	for i, account := range ks.Accounts() {
+		fmt.Printf("Account #%d: %s %s\n", i, account.Address.Hex(), account.URL.Path)
+	}
+	return nil
+}
+
+func accountsImport(cmd *cobra.Command, args []string) error {
+	ks, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimSpace(data)
+
+	var account accounts.Account
+	if bytes.HasPrefix(data, []byte("{")) {
+		passphrase, err := readPassphrase(passwordFile, "Passphrase of the keyfile", false)
+		if err != nil {
+			return err
+		}
+		newPassphrase := passphrase
+		if newPasswordFile != "" {
+			if newPassphrase, err = readPassphrase(newPasswordFile, "", true); err != nil {
+				return err
+			}
+		}
+		if account, err = ks.Import(data, passphrase, newPassphrase); err != nil {
+			return fmt.Errorf("error importing keyfile: %s", err)
+		}
+	} else {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(string(data), "0x"))
+		if err != nil {
+			return fmt.Errorf("file is neither a JSON keyfile nor a hex encoded private key: %s", err)
+		}
+		passphrase, err := readPassphrase(newPasswordFile, "Passphrase of the imported key", true)
+		if err != nil {
+			return err
+		}
+		if account, err = ks.ImportECDSA(key, passphrase); err != nil {
+			return fmt.Errorf("error importing key: %s", err)
+		}
+	}
+
+	fmt.Printf("Imported %s to %s\n", account.Address.Hex(), account.URL.Path)
+	return nil
+}
+
+func accountsExport(cmd *cobra.Command, args []string) error {
+	ks, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+
+	account, err := findAccount(ks, args[0])
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(passwordFile, "Passphrase of the key", false)
+	if err != nil {
+		return err
+	}
+	newPassphrase := passphrase
+	if newPasswordFile != "" {
+		if newPassphrase, err = readPassphrase(newPasswordFile, "", true); err != nil {
+			return err
+		}
+	}
+
+	keyJSON, err := ks.Export(account, passphrase, newPassphrase)
+	if err != nil {
+		return fmt.Errorf("error exporting key: %s", err)
+	}
+	if err := ioutil.WriteFile(args[1], keyJSON, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %s to %s\n", account.Address.Hex(), args[1])
+	return nil
+}
+
+func accountsUpdate(cmd *cobra.Command, args []string) error {
+	ks, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+
+	account, err := findAccount(ks, args[0])
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(passwordFile, "Current passphrase", false)
+	if err != nil {
+		return err
+	}
+	newPassphrase, err := readPassphrase(newPasswordFile, "New passphrase", true)
+	if err != nil {
+		return err
+	}
+
+	if err := ks.Update(account, passphrase, newPassphrase); err != nil {
+		return fmt.Errorf("error updating key: %s", err)
+	}
+
+	fmt.Printf("Updated the passphrase of %s\n", account.Address.Hex())
+	return nil
+}
+
+//openKeyStore opens the keystore directory of the node, with the same key
+//derivation parameters as the Service
+func openKeyStore() (*keystore.KeyStore, error) {
+	if err := os.MkdirAll(config.Eth.Keystore, 0700); err != nil {
+		return nil, err
+	}
+	return keystore.NewKeyStore(config.Eth.Keystore, keystore.StandardScryptN, keystore.StandardScryptP), nil
+}
+
+//findAccount returns the key of the keystore with the given address
+func findAccount(ks *keystore.KeyStore, address string) (accounts.Account, error) {
+	if !common.IsHexAddress(address) {
+		return accounts.Account{}, fmt.Errorf("invalid address %q", address)
+	}
+	account, err := ks.Find(accounts.Account{Address: common.HexToAddress(address)})
+	if err != nil {
+		return accounts.Account{}, fmt.Errorf("%s: %s", address, err)
+	}
+	return account, nil
+}
+
+//readPassphrase returns the first line of a password file or, if no file is
+//given, prompts for a passphrase on the terminal, twice if confirm is set
+func readPassphrase(file, prompt string, confirm bool) (string, error) {
+	if file != "" {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		line := strings.Split(string(text), "\n")[0]
+		// Sanitise DOS line endings.
+		return strings.TrimRight(line, "\r"), nil
+	}
+
+	passphrase, err := promptPassphrase(prompt + ": ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := promptPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+func promptPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal to prompt for a passphrase, use a password file")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+//setTestKeystore points the keystore of the configuration to a new directory
+//of dir, and returns a function which restores the configuration
+func setTestKeystore(dir, name string) func() {
+	keystoreDir := config.Eth.Keystore
+	config.Eth.Keystore = filepath.Join(dir, name)
+	return func() {
+		config.Eth.Keystore = keystoreDir
+	}
+}
+
+func runAccountsCmd(args ...string) error {
+	cmd := NewAccountsCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	return cmd.Execute()
+}
+
+//checkPassphrase checks that a key of the keystore is encrypted with a
+//passphrase
+func checkPassphrase(t *testing.T, account accounts.Account, passphrase string) {
+	ks, err := openKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock(account, passphrase); err != nil {
+		t.Fatalf("%s should be unlocked with %q: %v", account.Address.Hex(), passphrase, err)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setTestKeystore(dir, "keystore")()
+
+	pwd := writeTestFile(t, dir, "pwd.txt", "first\r\nignored\n")
+	newPwd := writeTestFile(t, dir, "new_pwd.txt", "second\n")
+
+	// Import a raw key
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	rawKey := writeTestFile(t, dir, "key.hex", "0x"+hex.EncodeToString(crypto.FromECDSA(key))+"\n")
+	if err := runAccountsCmd("import", rawKey, "--new-password-file", pwd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a key
+	if err := runAccountsCmd("new", "--new-password-file", pwd); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAccountsCmd("list"); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := openKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Accounts()) != 2 {
+		t.Fatalf("keystore should have 2 keys, not %d", len(ks.Accounts()))
+	}
+	account := accounts.Account{Address: address}
+	checkPassphrase(t, account, "first")
+
+	// Change the passphrase
+	if err := runAccountsCmd("update", address.Hex(), "--password-file", newPwd, "--new-password-file", pwd); err == nil {
+		t.Fatal("the current passphrase should be checked")
+	}
+	if err := runAccountsCmd("update", address.Hex(), "--password-file", pwd, "--new-password-file", newPwd); err != nil {
+		t.Fatal(err)
+	}
+	checkPassphrase(t, account, "second")
+
+	// Export it, encrypted with another passphrase, and import it elsewhere
+	keyfile := filepath.Join(dir, "exported.json")
+	if err := runAccountsCmd("export", address.Hex(), keyfile, "--password-file", newPwd, "--new-password-file", pwd); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAccountsCmd("export", "0x1111111111111111111111111111111111111111", keyfile, "--password-file", pwd); err == nil {
+		t.Fatal("an unknown address should be refused")
+	}
+
+	defer setTestKeystore(dir, "other")()
+	if err := runAccountsCmd("import", keyfile, "--password-file", newPwd); err == nil {
+		t.Fatal("the passphrase of the keyfile should be checked")
+	}
+	if err := runAccountsCmd("import", keyfile, "--password-file", pwd); err != nil {
+		t.Fatal(err)
+	}
+	checkPassphrase(t, account, "first")
+
+	garbage := writeTestFile(t, dir, "garbage.txt", "not a key")
+	if err := runAccountsCmd("import", garbage, "--new-password-file", pwd); err == nil {
+		t.Fatal("a file which is not a key should be refused")
+	}
+}
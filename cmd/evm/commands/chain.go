@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+var (
+	exportFrom int64
+	exportTo   int64
+)
+
+//AddExportFlags adds flags to the Export command
+func AddExportFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&exportFrom, "from", 0, "Index of the first block to export")
+	cmd.Flags().Int64Var(&exportTo, "to", -1, "Index of the last block to export (-1 for the last block)")
+}
+
+//NewExportCmd returns the command that exports the chain to a file
+func NewExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <file>",
+		Short: "Export blocks and their state roots to a file (gzipped if it ends with .gz)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  exportChain,
+	}
+
+	AddExportFlags(cmd)
+	return cmd
+}
+
+//NewImportCmd returns the command that imports the chain from a file
+func NewImportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import and re-execute the blocks of an exported file, checking their state roots",
+		Args:  cobra.ExactArgs(1),
+		RunE:  importChain,
+	}
+}
+
+//openState opens the state database of the node, which must not be running,
+//and checks it against the genesis file
+func openState() (*state.State, error) {
+	db, err := state.NewDatabase(config.Eth.DbBackend,
+		config.Eth.DbFile,
+		config.Eth.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("error opening state database: %s", err)
+	}
+
+	s, err := state.NewState(logger,
+		db,
+		config.Eth.StateDiffs,
+		config.Eth.Preimages)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening state: %s", err)
+	}
+
+	genesis, err := state.LoadGenesis(config.Eth.Genesis)
+	if err == nil {
+		_, err = s.InitGenesis(genesis)
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error initialising genesis: %s", err)
+	}
+	return s, nil
+}
+
+func exportChain(cmd *cobra.Command, args []string) error {
+	s, err := openState()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	out, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var writer io.Writer = out
+	if strings.HasSuffix(args[0], ".gz") {
+		gz := gzip.NewWriter(out)
+		defer gz.Close()
+		writer = gz
+	}
+
+	count, err := s.ExportChain(writer, exportFrom, exportTo)
+	if err != nil {
+		return fmt.Errorf("error exporting chain: %s", err)
+	}
+
+	fmt.Printf("Exported %d blocks to %s\n", count, args[0])
+	return nil
+}
+
+func importChain(cmd *cobra.Command, args []string) error {
+	s, err := openState()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var reader io.Reader = in
+	if strings.HasSuffix(args[0], ".gz") {
+		if reader, err = gzip.NewReader(in); err != nil {
+			return err
+		}
+	}
+
+	count, err := s.ImportChain(reader)
+	if err != nil {
+		return fmt.Errorf("error importing chain after %d blocks: %s", count, err)
+	}
+
+	fmt.Printf("Imported %d blocks from %s\n", count, args[0])
+	return nil
+}
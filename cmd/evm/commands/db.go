@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rewindTo  int64
+	reexecute bool
+)
+
+//NewDbCmd returns the command group that maintains the state database of a
+//stopped node
+func NewDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Maintain the state database (the node must be stopped)",
+	}
+
+	cmd.AddCommand(
+		NewRewindCmd(),
+		NewPruneCmd(),
+		NewVerifyCmd())
+
+	return cmd
+}
+
+//AddRewindFlags adds flags to the Rewind command
+func AddRewindFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&rewindTo, "to", 0, "Index of the block to rewind to")
+	if err := cmd.MarkFlagRequired("to"); err != nil {
+		panic("Unable to mark flag as required")
+	}
+}
+
+//NewRewindCmd returns the command that rewinds the chain to an earlier block
+func NewRewindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rewind",
+		Short: "Rewind the chain and state to an earlier block, deleting the blocks above it",
+		Args:  cobra.NoArgs,
+		RunE:  rewind,
+	}
+
+	AddRewindFlags(cmd)
+	return cmd
+}
+
+func rewind(cmd *cobra.Command, args []string) error {
+	s, err := openState()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	head := s.GetBlockIndex()
+	if err := s.Rewind(rewindTo); err != nil {
+		return fmt.Errorf("error rewinding to block %d: %s", rewindTo, err)
+	}
+
+	fmt.Printf("Rewound from block %d to block %d (root %s)\n", head, rewindTo, s.GetRoot().Hex())
+	return nil
+}
+
+//NewPruneCmd returns the command that deletes the state of all blocks but the
+//head one
+func NewPruneCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the state of all blocks but the head one, and compact the database",
+		Args:  cobra.NoArgs,
+		RunE:  prune,
+	}
+}
+
+func prune(cmd *cobra.Command, args []string) error {
+	s, err := openState()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	deleted, err := s.Prune()
+	if err != nil {
+		return fmt.Errorf("error pruning state: %s", err)
+	}
+
+	fmt.Printf("Deleted %d stale state entries, kept the state of block %d (root %s)\n",
+		deleted, s.GetBlockIndex(), s.GetRoot().Hex())
+	return nil
+}
+
+//AddVerifyFlags adds flags to the Verify command
+func AddVerifyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&reexecute, "reexecute", false, "Also re-execute blocks from the genesis file and compare state roots")
+}
+
+//NewVerifyCmd returns the command that checks the integrity of the database
+func NewVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the head state is complete and that block, transaction and receipt entries are consistent",
+		Args:  cobra.NoArgs,
+		RunE:  verify,
+	}
+
+	AddVerifyFlags(cmd)
+	return cmd
+}
+
+func verify(cmd *cobra.Command, args []string) error {
+	s, err := openState()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	report, err := s.Verify(reexecute, config.Eth.Genesis)
+	if err != nil {
+		return fmt.Errorf("error verifying database: %s", err)
+	}
+
+	fmt.Printf("Head block %d (root %s)\n", report.Head, report.Root.Hex())
+	fmt.Printf("Checked %d state nodes, %d blocks, %d transactions\n",
+		report.Nodes, report.Blocks, report.Transactions)
+	if reexecute {
+		fmt.Printf("Re-executed %d blocks\n", report.Reexecuted)
+	}
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+
+	return report.Err()
+}
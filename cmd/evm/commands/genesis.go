@@ -0,0 +1,391 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/spf13/cobra"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+var (
+	genesisChainID   uint64
+	genesisGasLimit  uint64
+	genesisTimestamp uint64
+	genesisExtraData string
+	genesisAllocs    []string
+	genesisCSV       string
+	genesisForce     bool
+
+	allocBalance string
+	allocNonce   uint64
+	allocStorage []string
+)
+
+//NewGenesisCmd returns the command group that builds and inspects the genesis
+//file (--eth.genesis)
+func NewGenesisCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "genesis",
+		Short: "Build and inspect the genesis file",
+	}
+
+	cmd.AddCommand(
+		NewGenesisInitCmd(),
+		NewGenesisAddAllocCmd(),
+		NewGenesisHashCmd(),
+		NewGenesisValidateCmd())
+
+	return cmd
+}
+
+//AddGenesisInitFlags adds flags to the Genesis Init command
+func AddGenesisInitFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&genesisChainID, "chain-id", 1, "Chain ID used to sign transactions")
+	cmd.Flags().Uint64Var(&genesisGasLimit, "gas-limit", 0, "Gas limit of blocks (0 for the default)")
+	cmd.Flags().Uint64Var(&genesisTimestamp, "timestamp", 0, "Timestamp of the genesis block")
+	cmd.Flags().StringVar(&genesisExtraData, "extra-data", "", "Hex encoded extra data of the genesis block")
+	cmd.Flags().StringSliceVar(&genesisAllocs, "alloc", nil, "Allocation as address=balance (can be repeated)")
+	cmd.Flags().StringVar(&genesisCSV, "csv", "", "CSV file of allocations, with address,balance[,nonce] rows")
+	cmd.Flags().BoolVar(&genesisForce, "force", false, "Overwrite an existing genesis file")
+}
+
+//NewGenesisInitCmd returns the command that creates a genesis file
+func NewGenesisInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a genesis file from flags and a CSV file of allocations",
+		Args:  cobra.NoArgs,
+		RunE:  genesisInit,
+	}
+
+	AddGenesisInitFlags(cmd)
+	return cmd
+}
+
+//AddGenesisAddAllocFlags adds flags to the Genesis AddAlloc command
+func AddGenesisAddAllocFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&allocBalance, "balance", "0", "Balance of the account (kept if it is already allocated)")
+	cmd.Flags().Uint64Var(&allocNonce, "nonce", 0, "Nonce of the account (kept if it is already allocated)")
+	cmd.Flags().StringSliceVar(&allocStorage, "storage", nil, "Storage slot as key=value (can be repeated)")
+}
+
+//NewGenesisAddAllocCmd returns the command that allocates a contract in the
+//genesis file
+func NewGenesisAddAllocCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add-alloc <address> <artifact>",
+		Short: "Allocate a contract, with the code and storage of a compiled artifact, in the genesis file",
+		Long: `Allocate a contract in the genesis file. The artifact is a Truffle, Hardhat or
+solc standard JSON artifact, from which the deployed bytecode is taken, the
+output of solc --bin-runtime, or a file containing the hex encoded code. Storage
+is taken from the "storage" object of a JSON artifact, and from --storage.`,
+		Args: cobra.ExactArgs(2),
+		RunE: genesisAddAlloc,
+	}
+
+	AddGenesisAddAllocFlags(cmd)
+	return cmd
+}
+
+//NewGenesisHashCmd returns the command that prints the genesis hash
+func NewGenesisHashCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "hash",
+		Short: "Print the hash of the genesis block defined by the genesis file",
+		Args:  cobra.NoArgs,
+		RunE:  genesisHash,
+	}
+}
+
+//NewGenesisValidateCmd returns the command that checks the genesis file
+func NewGenesisValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the fields and allocations of the genesis file",
+		Args:  cobra.NoArgs,
+		RunE:  genesisValidate,
+	}
+}
+
+func genesisInit(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(config.Eth.Genesis); err == nil && !genesisForce {
+		return fmt.Errorf("genesis file %s already exists (use --force to overwrite it)", config.Eth.Genesis)
+	}
+
+	genesis := state.DefaultGenesis()
+	genesis.Config.ChainID = new(big.Int).SetUint64(genesisChainID)
+	if genesisGasLimit != 0 {
+		genesis.GasLimit = math.HexOrDecimal64(genesisGasLimit)
+	}
+	genesis.Timestamp = math.HexOrDecimal64(genesisTimestamp)
+	if genesisExtraData != "" {
+		extra, err := hexutil.Decode(genesisExtraData)
+		if err != nil {
+			return fmt.Errorf("invalid extra data: %s", err)
+		}
+		genesis.ExtraData = extra
+	}
+
+	genesis.Alloc = make(state.GenesisAlloc)
+	for _, alloc := range genesisAllocs {
+		parts := strings.SplitN(alloc, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid allocation %q, expected address=balance", alloc)
+		}
+		genesis.Alloc[parts[0]] = state.GenesisAccount{Balance: parts[1]}
+	}
+	if genesisCSV != "" {
+		if err := readAllocCSV(genesisCSV, genesis.Alloc); err != nil {
+			return err
+		}
+	}
+
+	return saveGenesis(genesis)
+}
+
+//readAllocCSV adds the allocations of a CSV file, whose rows are
+//address,balance[,nonce]. A header row and lines starting with # are skipped.
+func readAllocCSV(file string, alloc state.GenesisAlloc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == 1 && !common.IsHexAddress(record[0]) {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return fmt.Errorf("%s:%d: expected address,balance[,nonce]", file, line)
+		}
+
+		account := state.GenesisAccount{Balance: record[1]}
+		if len(record) == 3 {
+			nonce, ok := math.ParseUint64(record[2])
+			if !ok {
+				return fmt.Errorf("%s:%d: invalid nonce %q", file, line, record[2])
+			}
+			account.Nonce = math.HexOrDecimal64(nonce)
+		}
+		alloc[record[0]] = account
+	}
+}
+
+func genesisAddAlloc(cmd *cobra.Command, args []string) error {
+	genesis, err := loadGenesisFile()
+	if err != nil {
+		return err
+	}
+
+	address, artifact := args[0], args[1]
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("invalid address %q", address)
+	}
+
+	code, storage, err := readArtifact(artifact)
+	if err != nil {
+		return fmt.Errorf("error reading artifact %s: %s", artifact, err)
+	}
+	for _, slot := range allocStorage {
+		parts := strings.SplitN(slot, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid storage slot %q, expected key=value", slot)
+		}
+		storage[parts[0]] = parts[1]
+	}
+
+	//an existing allocation of the address is replaced, but keeps its balance
+	//and nonce unless they are given
+	var account state.GenesisAccount
+	for addr, existing := range genesis.Alloc {
+		if common.HexToAddress(addr) == common.HexToAddress(address) {
+			account = existing
+			delete(genesis.Alloc, addr)
+		}
+	}
+	if cmd.Flags().Changed("balance") || account.Balance == "" {
+		account.Balance = allocBalance
+	}
+	if cmd.Flags().Changed("nonce") {
+		account.Nonce = math.HexOrDecimal64(allocNonce)
+	}
+	account.Code = code
+	account.Storage = storage
+	if genesis.Alloc == nil {
+		genesis.Alloc = make(state.GenesisAlloc)
+	}
+	genesis.Alloc[address] = account
+
+	if err := saveGenesis(genesis); err != nil {
+		return err
+	}
+
+	fmt.Printf("Allocated %d bytes of code and %d storage slots to %s\n",
+		(len(code)-2)/2, len(storage), common.HexToAddress(address).Hex())
+	return nil
+}
+
+//readArtifact returns the hex encoded runtime code of a compiled contract, and
+//the storage listed in the artifact, if any
+func readArtifact(file string) (string, map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	data = bytes.TrimSpace(data)
+	storage := make(map[string]string)
+
+	code := string(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		var artifact struct {
+			DeployedBytecode json.RawMessage `json:"deployedBytecode"`
+			BinRuntime       string          `json:"bin-runtime"`
+			Evm              struct {
+				DeployedBytecode struct {
+					Object string `json:"object"`
+				} `json:"deployedBytecode"`
+			} `json:"evm"`
+			Storage map[string]string `json:"storage"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return "", nil, err
+		}
+
+		code = artifact.BinRuntime
+		if artifact.Evm.DeployedBytecode.Object != "" {
+			code = artifact.Evm.DeployedBytecode.Object
+		}
+		if len(artifact.DeployedBytecode) != 0 {
+			//a string in Truffle and Hardhat artifacts, an object in Foundry ones
+			var object struct {
+				Object string `json:"object"`
+			}
+			if err := json.Unmarshal(artifact.DeployedBytecode, &code); err != nil {
+				if err := json.Unmarshal(artifact.DeployedBytecode, &object); err != nil {
+					return "", nil, fmt.Errorf("invalid deployedBytecode: %s", err)
+				}
+				code = object.Object
+			}
+		}
+		for key, value := range artifact.Storage {
+			storage[key] = value
+		}
+	}
+
+	code = "0x" + strings.TrimPrefix(code, "0x")
+	if strings.Contains(code, "__") {
+		return "", nil, fmt.Errorf("code has unlinked library references")
+	}
+	bin, err := hexutil.Decode(code)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid code: %s", err)
+	}
+	if len(bin) == 0 {
+		return "", nil, fmt.Errorf("no deployed code found")
+	}
+
+	return code, storage, nil
+}
+
+func genesisHash(cmd *cobra.Command, args []string) error {
+	genesis, err := loadGenesisFile()
+	if err != nil {
+		return err
+	}
+
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return fmt.Errorf("error building genesis block: %s", err)
+	}
+
+	fmt.Printf("Genesis hash: %s\n", block.Hash().Hex())
+	fmt.Printf("State root:   %s\n", block.Root.Hex())
+	fmt.Printf("Chain ID:     %v\n", genesis.Config.ChainID)
+	fmt.Printf("Accounts:     %d\n", len(genesis.Alloc))
+	return nil
+}
+
+func genesisValidate(cmd *cobra.Command, args []string) error {
+	data, err := ioutil.ReadFile(config.Eth.Genesis)
+	if err != nil {
+		return err
+	}
+
+	//unknown fields are most likely misspelt ones, which would be ignored
+	var strict state.Genesis
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&strict); err != nil {
+		return fmt.Errorf("invalid genesis file %s: %s", config.Eth.Genesis, err)
+	}
+
+	errs := strict.Validate()
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("genesis file %s has %d problems", config.Eth.Genesis, len(errs))
+	}
+
+	genesis, err := state.LoadGenesis(config.Eth.Genesis)
+	if err != nil {
+		return err
+	}
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return fmt.Errorf("error building genesis block: %s", err)
+	}
+
+	fmt.Printf("Genesis file %s is valid, genesis hash %s\n", config.Eth.Genesis, block.Hash().Hex())
+	return nil
+}
+
+//loadGenesisFile reads the genesis file, which must exist
+func loadGenesisFile() (*state.Genesis, error) {
+	if _, err := os.Stat(config.Eth.Genesis); err != nil {
+		return nil, fmt.Errorf("no genesis file: %s", err)
+	}
+	return state.LoadGenesis(config.Eth.Genesis)
+}
+
+//saveGenesis validates and writes the genesis file
+func saveGenesis(genesis *state.Genesis) error {
+	if errs := genesis.Validate(); len(errs) > 0 {
+		return errs[0]
+	}
+	if err := state.SaveGenesis(config.Eth.Genesis, genesis); err != nil {
+		return fmt.Errorf("error writing genesis file: %s", err)
+	}
+
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, genesis hash %s\n", config.Eth.Genesis, block.Hash().Hex())
+	return nil
+}
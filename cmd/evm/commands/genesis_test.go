@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+const (
+	testCode      = "0x6080604052600080fd00"
+	testAllocAddr = "0x6cC5F688a315f3dC28A7781717a9A798a59fDA7b"
+	testCSVAddr   = "0x1111111111111111111111111111111111111111"
+)
+
+//setTestGenesis points the genesis file of the configuration to a temporary
+//directory. It returns the directory, and a function which restores the
+//configuration and removes the directory.
+func setTestGenesis(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "evm-genesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisFile := config.Eth.Genesis
+	config.Eth.Genesis = filepath.Join(dir, "genesis.json")
+	return dir, func() {
+		config.Eth.Genesis = genesisFile
+		os.RemoveAll(dir)
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func runGenesisCmd(args ...string) error {
+	cmd := NewGenesisCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	return cmd.Execute()
+}
+
+func TestGenesisInit(t *testing.T) {
+	dir, cleanup := setTestGenesis(t)
+	defer cleanup()
+
+	csvFile := writeTestFile(t, dir, "alloc.csv",
+		"address,balance,nonce\n# comment\n"+testCSVAddr+",2000,7\n")
+
+	if err := runGenesisCmd("init",
+		"--chain-id", "1337",
+		"--alloc", testAllocAddr+"=1000",
+		"--csv", csvFile); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := state.LoadGenesis(config.Eth.Genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Config.ChainID.Int64() != 1337 {
+		t.Fatalf("chain ID should be 1337, not %v", genesis.Config.ChainID)
+	}
+	if genesis.Alloc[testAllocAddr].Balance != "1000" {
+		t.Fatalf("allocation should be read from the flags, not %+v", genesis.Alloc)
+	}
+	if account := genesis.Alloc[testCSVAddr]; account.Balance != "2000" || account.Nonce != 7 {
+		t.Fatalf("allocation should be read from the CSV file, not %+v", account)
+	}
+
+	// An existing genesis is only overwritten with --force
+	if err := runGenesisCmd("init"); err == nil {
+		t.Fatal("an existing genesis file should not be overwritten")
+	}
+	if err := runGenesisCmd("init", "--force"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid allocations are refused
+	if err := runGenesisCmd("init", "--force", "--alloc", testAllocAddr); err == nil {
+		t.Fatal("an allocation without balance should be refused")
+	}
+	badCSV := writeTestFile(t, dir, "bad.csv", testCSVAddr+",1,2,3\n")
+	if err := runGenesisCmd("init", "--force", "--csv", badCSV); err == nil {
+		t.Fatal("a CSV row with too many fields should be refused")
+	}
+}
+
+func TestGenesisAddAlloc(t *testing.T) {
+	dir, cleanup := setTestGenesis(t)
+	defer cleanup()
+
+	if err := runGenesisCmd("init", "--alloc", testAllocAddr+"=1000"); err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := writeTestFile(t, dir, "Test.json",
+		`{"deployedBytecode": "`+testCode+`", "storage": {"0x00": "0x01"}}`)
+	if err := runGenesisCmd("add-alloc", testAllocAddr, artifact, "--storage", "0x01=0x02"); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := state.LoadGenesis(config.Eth.Genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := genesis.Alloc[testAllocAddr]
+	if account.Code != testCode {
+		t.Fatalf("code should be %s, not %s", testCode, account.Code)
+	}
+	if account.Balance != "1000" {
+		t.Fatalf("existing balance should be kept, not %s", account.Balance)
+	}
+	if account.Storage["0x00"] != "0x01" || account.Storage["0x01"] != "0x02" {
+		t.Fatalf("storage should be read from the artifact and the flags, not %v", account.Storage)
+	}
+
+	// The code is in the state of the genesis
+	db, err := state.NewDatabase(state.MemoryBackend, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := state.NewState(logger, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.InitGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if code := s.GetCode(common.HexToAddress(testAllocAddr)); common.ToHex(code) != testCode {
+		t.Fatalf("genesis state should have the code, not %x", code)
+	}
+
+	// Libraries must be linked
+	unlinked := writeTestFile(t, dir, "Unlinked.bin", "6080__$lib$__00")
+	if err := runGenesisCmd("add-alloc", testAllocAddr, unlinked); err == nil {
+		t.Fatal("code with unlinked libraries should be refused")
+	}
+}
+
+func TestReadArtifact(t *testing.T) {
+	dir, cleanup := setTestGenesis(t)
+	defer cleanup()
+
+	artifacts := map[string]string{
+		"hardhat.json":  `{"deployedBytecode": "` + testCode + `"}`,
+		"foundry.json":  `{"deployedBytecode": {"object": "` + testCode + `"}}`,
+		"solc.json":     `{"evm": {"deployedBytecode": {"object": "` + testCode[2:] + `"}}}`,
+		"combined.json": `{"bin-runtime": "` + testCode[2:] + `"}`,
+		"runtime.bin":   testCode[2:] + "\n",
+	}
+	for name, content := range artifacts {
+		code, _, err := readArtifact(writeTestFile(t, dir, name, content))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if code != testCode {
+			t.Fatalf("%s: code should be %s, not %s", name, testCode, code)
+		}
+	}
+
+	if _, _, err := readArtifact(writeTestFile(t, dir, "abi.json", `{"abi": []}`)); err == nil {
+		t.Fatal("an artifact without code should be refused")
+	}
+}
+
+func TestGenesisHashValidate(t *testing.T) {
+	dir, cleanup := setTestGenesis(t)
+	defer cleanup()
+
+	if err := runGenesisCmd("hash"); err == nil {
+		t.Fatal("hash needs a genesis file")
+	}
+
+	if err := runGenesisCmd("init", "--alloc", testAllocAddr+"=1000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGenesisCmd("hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGenesisCmd("validate"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Misspelt fields and invalid allocations are reported
+	writeTestFile(t, dir, "genesis.json", `{"alloc": {}, "gasLimt": "0x1"}`)
+	if err := runGenesisCmd("validate"); err == nil {
+		t.Fatal("an unknown field should be reported")
+	}
+	writeTestFile(t, dir, "genesis.json", `{"alloc": {"`+testAllocAddr+`": {"balance": "-1"}}}`)
+	if err := runGenesisCmd("validate"); err == nil {
+		t.Fatal("a negative balance should be reported")
+	}
+}
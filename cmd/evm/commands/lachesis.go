@@ -22,6 +22,7 @@ func AddLachesisFlags(cmd *cobra.Command) {
 	cmd.Flags().Int64("lachesis.sync-limit", config.Lachesis.SyncLimit, "Max number of Events per sync")
 	cmd.Flags().Int("lachesis.max-pool", config.Lachesis.MaxPool, "Max number of pool connections")
 	cmd.Flags().Bool("lachesis.store", config.Lachesis.Store, "use persistent store")
+	cmd.Flags().String("lachesis.store-path", config.Lachesis.StorePath, "Location of the persistent store (default <lachesis.datadir>/badger_db)")
 	if err := viper.BindPFlags(cmd.Flags()); err != nil {
 		panic("Unable to bind viper flags")
 	}
@@ -18,6 +18,9 @@ func AddRaftFlags(cmd *cobra.Command) {
 	cmd.Flags().String("raft.snapshot-dir", config.Raft.SnapshotDir, "Snapshot directory")
 	cmd.Flags().String("raft.node-addr", config.Raft.NodeAddr, "IP:PORT of Raft node")
 	cmd.Flags().String("raft.server-id", string(config.Raft.LocalID), "Unique ID of this server")
+	cmd.Flags().Int("raft.max-batch-txs", config.Raft.MaxBatchTxs, "Max number of transactions per block")
+	cmd.Flags().Int("raft.max-batch-size", config.Raft.MaxBatchSize, "Max number of transaction bytes per block")
+	cmd.Flags().Duration("raft.batch-timeout", config.Raft.BatchTimeout, "Max time to wait for transactions before proposing a block")
 
 	if err := viper.BindPFlags(cmd.Flags()); err != nil {
 		panic("Unable to bind viper flags")
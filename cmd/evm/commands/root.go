@@ -23,11 +23,24 @@ func init() {
 
 	//Eth
 	RootCmd.PersistentFlags().String("eth.genesis", config.Eth.Genesis, "Location of genesis file")
+	RootCmd.PersistentFlags().String("eth.genesis-hash", config.Eth.GenesisHash, "Expected hash of the genesis block of the network")
 	RootCmd.PersistentFlags().String("eth.keystore", config.Eth.Keystore, "Location of Ethereum account keys")
 	RootCmd.PersistentFlags().String("eth.pwd", config.Eth.PwdFile, "Password file to unlock accounts")
+	RootCmd.PersistentFlags().StringSlice("eth.locked", config.Eth.Locked, "Addresses of accounts which are not unlocked at startup")
+	RootCmd.PersistentFlags().Duration("eth.unlock-duration", config.Eth.UnlockDuration, "Duration of the unlock of accounts at startup (0 until the node stops)")
+	RootCmd.PersistentFlags().String("eth.signer", config.Eth.Signer, "External signer endpoint (Unix socket or loopback http URL) used instead of the keystore")
 	RootCmd.PersistentFlags().String("eth.db", config.Eth.DbFile, "Eth database file")
+	RootCmd.PersistentFlags().String("eth.db-backend", config.Eth.DbBackend, "Eth database backend: leveldb, memory or badger")
 	RootCmd.PersistentFlags().String("eth.listen", config.Eth.EthAPIAddr, "Address of HTTP API service")
 	RootCmd.PersistentFlags().Int("eth.cache", config.Eth.Cache, "Megabytes of memory allocated to internal caching (min 16MB / database forced)")
+	RootCmd.PersistentFlags().String("eth.read-consistency", config.Eth.ReadConsistency, "Default consistency of API reads: stale, lease or linearizable")
+	RootCmd.PersistentFlags().Bool("eth.state-diffs", config.Eth.StateDiffs, "Record the state changes of every block")
+	RootCmd.PersistentFlags().Bool("eth.preimages", config.Eth.Preimages, "Record the preimages of the hashes computed by the EVM")
+	RootCmd.PersistentFlags().String("eth.gcmode", config.Eth.GCMode, "Garbage collection mode: archive or pruned")
+	RootCmd.PersistentFlags().Int("eth.trie-roots", config.Eth.TrieRoots, "Number of recent block states kept in memory in pruned mode")
+	RootCmd.PersistentFlags().Duration("eth.trie-flush", config.Eth.TrieFlush, "Interval between writes of the head state to disk in pruned mode")
+	RootCmd.PersistentFlags().Bool("eth.verify", config.Eth.Verify, "Check the integrity of the database at startup")
+	RootCmd.PersistentFlags().StringSlice("eth.trusted-roots", config.Eth.TrustedRoots, "Trusted state roots (<block>:<root>) of the snapshots a new node can restore")
 
 }
 
@@ -2,9 +2,7 @@ package commands
 
 import (
 	"fmt"
-	"html/template"
 	"os"
-	"path/filepath"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -12,23 +10,15 @@ import (
 
 	"github.com/Fantom-foundation/go-evm/src/consensus/solo"
 	"github.com/Fantom-foundation/go-evm/src/engine"
+	"github.com/Fantom-foundation/go-evm/src/state"
 )
 
-var genesisTemplate = `
-{
-	"alloc": {
-			"{{.}}": {
-					"balance": "1000000000000000000000000000"
-			}
-	}
-}
-`
-
 var genesisAddress string
 
 //AddSoloFlags adds flags to the Solo command
 func AddSoloFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&genesisAddress, "genesis", "", "create genesis file specifying pre-funded account with given address")
+	cmd.Flags().Duration("solo.block-time", config.Solo.BlockTime, "Interval between blocks (0 to produce a block for each transaction)")
 	if err := viper.BindPFlags(cmd.Flags()); err != nil {
 		panic("Unable to bind viper flags")
 	}
@@ -45,6 +35,7 @@ func NewSoloCmd() *cobra.Command {
 
 			logger.WithFields(logrus.Fields{
 				"Eth":     config.Eth,
+				"Solo":    config.Solo,
 				"genesis": genesisAddress,
 			}).Debug("Config")
 
@@ -63,6 +54,7 @@ func NewSoloCmd() *cobra.Command {
 	return cmd
 }
 
+//createGenesis writes a genesis file which allocates funds to an address
 func createGenesis(genesisFile, genesisAddr string) error {
 
 	if _, err := os.Stat(genesisFile); err == nil {
@@ -70,33 +62,21 @@ func createGenesis(genesisFile, genesisAddr string) error {
 		return err
 	}
 
-	t := template.New("genesis")
-	t, err := t.Parse(genesisTemplate) // parsing of template string
-	if err != nil {
-		logger.WithError(err).Error("Parsing genesis template")
-		return err
-	}
-
-	genDir := filepath.Dir(genesisFile)
-	if _, err := os.Stat(genDir); os.IsNotExist(err) {
-		err = os.MkdirAll(genDir, 0755)
-		if err != nil {
-			logger.WithError(err).Error("Creating base directory of genesis file")
-			return err
-		}
+	genesis := state.DefaultGenesis()
+	genesis.Alloc = state.GenesisAlloc{
+		genesisAddr: {Balance: "1000000000000000000000000000"},
 	}
 
-	f, err := os.OpenFile(genesisFile, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		logger.WithError(err).Errorf("Creating file %s", genesisFile)
+	if err := state.SaveGenesis(genesisFile, genesis); err != nil {
+		logger.WithError(err).Errorf("Writing genesis file %s", genesisFile)
 		return err
 	}
 
-	return t.Execute(f, genesisAddr)
+	return nil
 }
 
 func runSolo(cmd *cobra.Command, args []string) error {
-	soloConsensus := solo.NewSolo(logger)
+	soloConsensus := solo.NewSolo(*config.Solo, logger)
 	soloEngine, err := engine.NewConsensusEngine(*config, soloConsensus, logger)
 	if err != nil {
 		return fmt.Errorf("error building Engine: %s", err)
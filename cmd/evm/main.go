@@ -13,6 +13,11 @@ func main() {
 		cmd.NewSoloCmd(),
 		cmd.NewRaftCmd(),
 		cmd.NewRunCmd(),
+		cmd.NewExportCmd(),
+		cmd.NewImportCmd(),
+		cmd.NewDbCmd(),
+		cmd.NewGenesisCmd(),
+		cmd.NewAccountsCmd(),
 		cmd.VersionCmd)
 
 	//Do not print usage when error occurs
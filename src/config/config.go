@@ -28,6 +28,9 @@ type Config struct {
 	// Options for Raft consensus
 	Raft *RaftConfig `mapstructure:"raft"`
 
+	// Options for Solo consensus
+	Solo *SoloConfig `mapstructure:"solo"`
+
 	ProxyAddr  string `mapstructure:"proxy"`
 	ClientAddr string `mapstructure:"client-connect"`
 	Standalone bool   `mapstructure:"standalone"`
@@ -41,6 +44,7 @@ func DefaultConfig() *Config {
 		Eth:        DefaultEthConfig(),
 		Lachesis:   DefaultLachesisConfig(),
 		Raft:       DefaultRaftConfig(),
+		Solo:       DefaultSoloConfig(),
 		ProxyAddr:  "127.0.0.1:1338",
 		ClientAddr: "127.0.0.1:1339",
 		Pidfile:    filepath.Join(os.TempDir(), "go-evm.pid"),
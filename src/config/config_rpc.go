@@ -13,7 +13,7 @@ const (
 )
 
 var (
-	DefaultModules = []string{"admin", "personal", "txpool", "eth", "net", "web3", "miner", "debug"}
+	DefaultModules = []string{"admin", "personal", "txpool", "eth", "net", "web3", "miner", "debug", "evm", "dev"}
 )
 
 // DefaultRpcConfig contains reasonable default settings.
@@ -1,6 +1,9 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
 	defaultEthAPIAddr   = ":8080"
@@ -10,6 +13,11 @@ var (
 	defaultGenesisFile  = fmt.Sprintf("%s/genesis.json", defaultEthDir)
 	defaultPwdFile      = fmt.Sprintf("%s/pwd.txt", defaultEthDir)
 	defaultDbFile       = fmt.Sprintf("%s/chaindata", defaultEthDir)
+	defaultConsistency  = "stale"
+	defaultDbBackend    = "leveldb"
+	defaultGCMode       = "archive"
+	defaultTrieRoots    = 128
+	defaultTrieFlush    = 5 * time.Minute
 )
 
 // EthConfig contains the configuration relative to the accounts, EVM, trie/db,
@@ -18,34 +26,92 @@ type EthConfig struct {
 	// Genesis file
 	Genesis string `mapstructure:"genesis"`
 
+	// Hash of the genesis block of the network. If set, the node refuses to
+	// start with a genesis file which gives another hash.
+	GenesisHash string `mapstructure:"genesis-hash"`
+
 	// Location of ethereum account keys
 	Keystore string `mapstructure:"keystore"`
 
-	// File containing passwords to unlock ethereum accounts
+	// File containing passwords to unlock ethereum accounts: a JSON object
+	// mapping addresses to passwords, or one password per line in the order of
+	// the keystore accounts (the last one applying to the remaining accounts)
 	PwdFile string `mapstructure:"pwd"`
 
+	// Addresses of the accounts which are not unlocked at startup
+	Locked []string `mapstructure:"locked"`
+
+	// Duration of the unlock of accounts at startup (0 keeps them unlocked
+	// until the node stops)
+	UnlockDuration time.Duration `mapstructure:"unlock-duration"`
+
+	// Endpoint of an external signer, the path of a Unix socket or a loopback
+	// http URL. If set, transactions are signed by the signer, and the keystore
+	// is not used.
+	Signer string `mapstructure:"signer"`
+
 	// File containing the levelDB database
 	DbFile string `mapstructure:"db"`
 
+	// Storage backend of the database: leveldb, memory or badger
+	DbBackend string `mapstructure:"db-backend"`
+
 	// Address of HTTP API Service
 	EthAPIAddr string `mapstructure:"listen"`
 
 	// Megabytes of memory allocated to internal caching (min 16MB / database forced)
 	Cache int `mapstructure:"cache"`
+
+	// Default consistency level of reads served by the API (stale, lease or
+	// linearizable). It can be overridden per request.
+	ReadConsistency string `mapstructure:"read-consistency"`
+
+	// Record the accounts and storage slots changed by every block
+	StateDiffs bool `mapstructure:"state-diffs"`
+
+	// Record the preimages of the hashes computed by the EVM
+	Preimages bool `mapstructure:"preimages"`
+
+	// Garbage collection mode: "archive" writes the state of every block to
+	// disk, "pruned" only keeps the state of recent blocks
+	GCMode string `mapstructure:"gcmode"`
+
+	// Number of recent block states kept in memory in pruned mode
+	TrieRoots int `mapstructure:"trie-roots"`
+
+	// Interval between writes of the head state to disk in pruned mode
+	TrieFlush time.Duration `mapstructure:"trie-flush"`
+
+	// Check the integrity of the database at startup
+	Verify bool `mapstructure:"verify"`
+
+	// State roots of blocks, as "<block>:<root>", which a node without the
+	// blocks can restore snapshots of
+	TrustedRoots []string `mapstructure:"trusted-roots"`
 }
 
 // DefaultEthConfig return the default configuration for Eth services
 func DefaultEthConfig() *EthConfig {
 	return &EthConfig{
-		Genesis:    defaultGenesisFile,
-		Keystore:   defaultKeystoreFile,
-		PwdFile:    defaultPwdFile,
-		DbFile:     defaultDbFile,
-		EthAPIAddr: defaultEthAPIAddr,
-		Cache:      defaultCache,
+		Genesis:         defaultGenesisFile,
+		Keystore:        defaultKeystoreFile,
+		PwdFile:         defaultPwdFile,
+		DbFile:          defaultDbFile,
+		DbBackend:       defaultDbBackend,
+		EthAPIAddr:      defaultEthAPIAddr,
+		Cache:           defaultCache,
+		ReadConsistency: defaultConsistency,
+		GCMode:          defaultGCMode,
+		TrieRoots:       defaultTrieRoots,
+		TrieFlush:       defaultTrieFlush,
 	}
 }
 
+// Pruned reports whether the state of old blocks should be garbage collected
+func (c *EthConfig) Pruned() bool {
+	return c.GCMode == "pruned"
+}
+
 // SetDataDir updates the eth configuration directories if they were set to
 // default values.
 func (c *EthConfig) SetDataDir(datadir string) {
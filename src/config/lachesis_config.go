@@ -52,6 +52,10 @@ type LachesisConfig struct {
 
 	// Database type; badger or inmeum
 	Store bool `mapstructure:"store"`
+
+	// Location of the badger database, when Store is set. Defaults to
+	// <datadir>/badger_db
+	StorePath string `mapstructure:"store-path"`
 }
 
 // DefaultLachesisConfig returns the default configuration for a Lachesis node
@@ -76,6 +80,14 @@ func (c *LachesisConfig) SetDataDir(datadir string) {
 	}
 }
 
+// BadgerDir returns the location of the persistent poset store
+func (c *LachesisConfig) BadgerDir() string {
+	if c.StorePath != "" {
+		return c.StorePath
+	}
+	return fmt.Sprintf("%s/badger_db", c.DataDir)
+}
+
 // ToRealLachesisConfig converts an evm/src/config.LachesisConfig to a
 // lachesis/src/lachesis.LachesisConfig as used by Lachesis
 func (c *LachesisConfig) ToRealLachesisConfig(logger *logrus.Logger) *_lachesis.LachesisConfig {
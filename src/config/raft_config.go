@@ -87,6 +87,20 @@ type RaftConfig struct {
 	RaftDir     string `mapstructure:"dir"`
 	SnapshotDir string `mapstructure:"snapshot-dir"`
 	NodeAddr    string `mapstructure:"node-addr"`
+
+	/*------------------------------------------------------------------------*/
+
+	// MaxBatchTxs is the maximum number of transactions the leader packs into
+	// a single block proposal.
+	MaxBatchTxs int `mapstructure:"max-batch-txs"`
+
+	// MaxBatchSize is the maximum number of transaction bytes the leader packs
+	// into a single block proposal.
+	MaxBatchSize int `mapstructure:"max-batch-size"`
+
+	// BatchTimeout is the maximum time the leader holds on to transactions
+	// before proposing a block, even if the batch is not full.
+	BatchTimeout time.Duration `mapstructure:"batch-timeout"`
 }
 
 // DefaultRaftConfig returns the default configuration for a Raft node
@@ -106,6 +120,9 @@ func DefaultRaftConfig() *RaftConfig {
 		RaftDir:            defaultRaftDir,
 		SnapshotDir:        defaultSnapshotDir,
 		NodeAddr:           defaultNodeAddr,
+		MaxBatchTxs:        1000,
+		MaxBatchSize:       1024 * 1024,
+		BatchTimeout:       200 * time.Millisecond,
 	}
 }
 
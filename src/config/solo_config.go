@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// SoloConfig contains the configuration of the Solo consensus
+type SoloConfig struct {
+	// Interval at which blocks are produced. If 0, a block is produced as soon
+	// as a transaction is received (automine).
+	BlockTime time.Duration `mapstructure:"block-time"`
+}
+
+// DefaultSoloConfig returns the default configuration for Solo consensus
+func DefaultSoloConfig() *SoloConfig {
+	return &SoloConfig{
+		BlockTime: 0,
+	}
+}
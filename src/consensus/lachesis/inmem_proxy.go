@@ -1,7 +1,6 @@
 package lachesis
 
 import (
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
 
 	"github.com/Fantom-foundation/go-evm/src/service"
@@ -48,28 +47,20 @@ func (i *InmemProxy) SubmitInternalCh() chan poset.InternalTransaction {
 // CommitBlock commits Block to the State and expects the resulting state hash
 func (i *InmemProxy) CommitBlock(block poset.Block) ([]byte, error) {
 	i.logger.Debug("CommitBlock")
-
-	blockHash := common.BytesToHash(block.Hash)
-
-	for x, tx := range block.Transactions() {
-		if err := i.state.ApplyTransaction(tx, x, blockHash); err != nil {
-			return []byte{}, err
-		}
-	}
-
-	hash, err := i.state.Commit()
-	if err != nil {
-		return []byte{}, err
-	}
-
-	return hash.Bytes(), nil
+	stateHash, err := i.state.ProcessLachesisBlock(block)
+	return stateHash.Bytes(), err
 }
 
-//TODO - Implement these two functions
+// GetSnapshot returns a snapshot of the State after the block with the given
+// index
 func (i *InmemProxy) GetSnapshot(blockIndex int64) ([]byte, error) {
-	return []byte{}, nil
+	i.logger.WithField("block", blockIndex).Debug("GetSnapshot")
+	return i.state.GetLachesisSnapshot(blockIndex)
 }
 
+// Restore resets the State from a snapshot
 func (i *InmemProxy) Restore(snapshot []byte) error {
-	return nil
+	i.logger.Debug("Restore")
+	_, err := i.state.Restore(snapshot)
+	return err
 }
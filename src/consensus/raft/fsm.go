@@ -1,16 +1,21 @@
 package raft
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
-	_ethCommon "github.com/ethereum/go-ethereum/common"
 	_raft "github.com/hashicorp/raft"
 	"github.com/sirupsen/logrus"
 
 	"github.com/Fantom-foundation/go-evm/src/state"
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
 )
 
+// errProcessedBlock is returned for the proposal of a block which was already
+// processed
+var errProcessedBlock = errors.New("block already processed")
+
 // FSM wraps a state object and implements the Raft FSM interface
 type FSM struct {
 	state  *state.State
@@ -30,27 +35,71 @@ IMPLEMENT RAFT FSM INTERFACE
 *******************************************************************************/
 
 // Apply is invoked once a log entry is committed.
-// It applies the log data to the state as a transaction.
+// It decodes the block proposal contained in the log data, and processes it as
+// the next block of the chain. Every node applies the same sequence of log
+// entries, so the resulting block indexes, hashes and state roots are identical
+// throughout the cluster.
+//
+// The FSM has no snapshots, so Raft replays the whole log when a node restarts,
+// and a new leader may propose blocks which a previous leader already produced.
+// Proposals at or below the head of the chain are skipped, which every node does
+// the same way since they all hold the same chain.
 func (f *FSM) Apply(log *_raft.Log) interface{} {
 
 	f.logger.WithFields(logrus.Fields{
 		"index": log.Index,
 		"term":  log.Term,
 		"type":  log.Type,
-		"data":  log.Data,
 	}).Debug("Apply")
 
-	if err := f.state.ApplyTransaction(log.Data, int(log.Index), _ethCommon.Hash{}); err != nil {
-		f.logger.WithError(err).Error("Error applying transaction")
-		return nil
+	var proposal blockProposal
+	if err := proposal.Unmarshal(log.Data); err != nil {
+		f.logger.WithError(err).Error("Error decoding block proposal")
+		return err
+	}
+
+	// a node initialised with another genesis must not apply the blocks of the
+	// cluster
+	if genesis := f.state.GenesisHash(); proposal.Genesis != genesis {
+		err := fmt.Errorf("block proposal for genesis %s, this node has genesis %s",
+			proposal.Genesis.Hex(), genesis.Hex())
+		f.logger.WithError(err).Error("Genesis mismatch")
+		return err
 	}
 
-	hash, err := f.state.Commit()
+	head := f.state.GetBlockIndex()
+	index := int64(proposal.Index)
+	if index <= head {
+		f.logger.WithFields(logrus.Fields{
+			"block": index,
+			"head":  head,
+		}).Debug("Skipping processed block")
+		return errProcessedBlock
+	}
+	if index > head+1 {
+		err := fmt.Errorf("block proposal %d does not follow head %d", index, head)
+		f.logger.WithError(err).Error("Error processing block")
+		return err
+	}
+
+	block := poset.NewBlock(index,
+		int64(log.Index),
+		nil,
+		proposal.Transactions)
+	block.CreatedTime = int64(proposal.Timestamp)
+
+	hash, err := f.state.ProcessBlock(block)
 	if err != nil {
-		f.logger.WithError(err).Error("Error committing")
-		return nil
+		f.logger.WithError(err).Error("Error processing block")
+		return err
 	}
 
+	f.logger.WithFields(logrus.Fields{
+		"block": block.Index(),
+		"txs":   len(proposal.Transactions),
+		"root":  hash.Hex(),
+	}).Debug("Applied block")
+
 	return hash.Bytes()
 }
 
@@ -0,0 +1,139 @@
+package raft
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	_raft "github.com/hashicorp/raft"
+	"github.com/sirupsen/logrus"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+func newTestState(dbFile string, genesis *state.Genesis, logger *logrus.Logger, t *testing.T) *state.State {
+	db, err := state.NewDatabase(state.LevelDBBackend, dbFile, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := state.NewState(logger, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InitGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func proposalLog(t *testing.T, s *state.State, logIndex uint64, blockIndex int64, txs ...*ethTypes.Transaction) *_raft.Log {
+	var data [][]byte
+	for _, tx := range txs {
+		txBytes, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, txBytes)
+	}
+	proposal, err := newBlockProposal(s.GenesisHash(), blockIndex, 1000+blockIndex, data).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &_raft.Log{Index: logIndex, Term: 1, Type: _raft.LogCommand, Data: proposal}
+}
+
+func TestFSMReplay(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "evm-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	dbFile := filepath.Join(dataDir, "chaindata")
+
+	logger := bcommon.NewTestLogger(t)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	genesis := state.DefaultGenesis()
+	genesis.Alloc = state.GenesisAlloc{from.Hex(): {Balance: "1000000000"}}
+
+	signer := ethTypes.NewEIP155Signer(genesis.Config.ChainID)
+	var txs []*ethTypes.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx, err := ethTypes.SignTx(ethTypes.NewTransaction(nonce, from, big.NewInt(1), 21000, big.NewInt(0), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	s := newTestState(dbFile, genesis, logger, t)
+	fsm := NewFSM(s, logger.WithField("module", "raft"))
+
+	logs := []*_raft.Log{
+		proposalLog(t, s, 1, 1, txs[0]),
+		proposalLog(t, s, 2, 2, txs[1]),
+	}
+	for _, l := range logs {
+		if err, ok := fsm.Apply(l).(error); ok {
+			t.Fatal(err)
+		}
+	}
+	root := s.GetRoot()
+	s.Close()
+
+	// Raft replays the whole log on restart
+	s = newTestState(dbFile, genesis, logger, t)
+	defer s.Close()
+	fsm = NewFSM(s, logger.WithField("module", "raft"))
+
+	for _, l := range logs {
+		if res := fsm.Apply(l); res != errProcessedBlock {
+			t.Fatalf("replayed entry %d should be skipped, not return %v", l.Index, res)
+		}
+	}
+	if s.GetBlockIndex() != 2 {
+		t.Fatalf("head should stay at block 2, not %d", s.GetBlockIndex())
+	}
+	if s.GetRoot() != root {
+		t.Fatalf("root should stay %v, not %v", root.Hex(), s.GetRoot().Hex())
+	}
+	for _, tx := range txs[:2] {
+		receipt, err := s.GetReceipt(tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Status != ethTypes.ReceiptStatusSuccessful {
+			t.Fatalf("receipt of %v should not be overwritten by the replay", tx.Hash().Hex())
+		}
+	}
+
+	// A block beyond the next one is a gap
+	if _, ok := fsm.Apply(proposalLog(t, s, 3, 4, txs[2])).(error); !ok {
+		t.Fatal("a block which does not follow the head should be refused")
+	}
+
+	// The next block is applied
+	if err, ok := fsm.Apply(proposalLog(t, s, 4, 3, txs[2])).(error); ok {
+		t.Fatal(err)
+	}
+	if s.GetBlockIndex() != 3 {
+		t.Fatalf("head should be block 3, not %d", s.GetBlockIndex())
+	}
+	block, err := s.GetBlockById(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.GetCreatedTime() != 1003 {
+		t.Fatalf("block time should be taken from the proposal, not %d", block.GetCreatedTime())
+	}
+}
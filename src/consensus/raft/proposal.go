@@ -0,0 +1,38 @@
+package raft
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// blockProposal is the payload of a Raft log entry. It is a batch of
+// transactions collected by the leader, along with the index of the block and
+// the time at which it was proposed, so that every node builds exactly the
+// same block from it. It also carries the genesis hash of the leader, which
+// followers check against their own.
+type blockProposal struct {
+	Genesis      common.Hash
+	Index        uint64
+	Timestamp    uint64
+	Transactions [][]byte
+}
+
+// newBlockProposal creates a blockProposal
+func newBlockProposal(genesis common.Hash, index int64, timestamp int64, transactions [][]byte) *blockProposal {
+	return &blockProposal{
+		Genesis:      genesis,
+		Index:        uint64(index),
+		Timestamp:    uint64(timestamp),
+		Transactions: transactions,
+	}
+}
+
+// Marshal RLP encodes the proposal
+func (p *blockProposal) Marshal() ([]byte, error) {
+	return rlp.EncodeToBytes(p)
+}
+
+// Unmarshal decodes an RLP encoded proposal
+func (p *blockProposal) Unmarshal(data []byte) error {
+	return rlp.DecodeBytes(data, p)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
 	_raft "github.com/hashicorp/raft"
@@ -19,19 +20,36 @@ import (
 type Raft struct {
 	config    config.RaftConfig
 	service   *service.Service
-	fsm       _raft.FSM
+	fsm       *FSM
 	raftNode  *_raft.Raft
 	logger    *logrus.Entry
 	terminate chan os.Signal
 	txIndex   int
+
+	// batches of transactions waiting to be proposed, and index of the next
+	// block to propose, which is only known once the leader has applied the
+	// blocks of the previous leader (synced)
+	proposeCh chan [][]byte
+	nextIndex int64
+	synced    bool
+
+	// term in which a barrier confirmed that the entries of previous leaders
+	// were applied, after which lease reads can be served
+	leaseMutex sync.Mutex
+	leaseTerm  string
 }
 
+// proposeQueueSize is the number of batches which can wait to be proposed
+// before Run blocks
+const proposeQueueSize = 64
+
 // NewRaft returns a new Raft object
 func NewRaft(config config.RaftConfig, logger *logrus.Logger) *Raft {
 	return &Raft{
 		config:    config,
 		logger:    logger.WithField("module", "raft"),
 		terminate: make(chan os.Signal, 1),
+		proposeCh: make(chan [][]byte, proposeQueueSize),
 	}
 }
 
@@ -45,6 +63,7 @@ func (r *Raft) Init(state *state.State, service *service.Service) error {
 	r.logger.Debug("INIT")
 
 	r.service = service
+	r.service.SetReadBarrierCallback(r.ReadBarrier)
 
 	r.fsm = NewFSM(state, r.logger)
 
@@ -93,12 +112,34 @@ func (r *Raft) Init(state *state.State, service *service.Service) error {
 	return nil
 }
 
-// Run starts the Raft node and service
+// Run starts the Raft node and service.
+// The leader collects incoming transactions into batches, which it proposes as
+// blocks once they reach MaxBatchTxs transactions, MaxBatchSize bytes, or when
+// BatchTimeout has elapsed since the first transaction of the batch. Batches
+// are proposed in the background, so that collecting transactions doesn't wait
+// for blocks to be committed.
 func (r *Raft) Run() error {
 
 	// Relay submitCh to Raft
 	submitCh := r.service.GetSubmitCh()
 	signal.Notify(r.terminate, os.Interrupt)
+
+	go r.propose()
+	defer close(r.proposeCh)
+
+	var (
+		batch     [][]byte
+		batchSize int
+		timeoutCh <-chan time.Time
+	)
+
+	flush := func() {
+		if len(batch) > 0 {
+			r.proposeCh <- batch
+		}
+		batch, batchSize, timeoutCh = nil, 0, nil
+	}
+
 	for {
 		select {
 		case t := <-submitCh:
@@ -113,13 +154,18 @@ func (r *Raft) Run() error {
 				break
 			}
 
-			f := r.raftNode.Apply(t, r.config.CommitTimeout)
-			if err := f.Error(); err != nil {
-				r.logger.WithError(err).Error("Applying Raft tx")
-				break
+			if len(batch) == 0 {
+				timeoutCh = time.After(r.config.BatchTimeout)
 			}
-
+			batch = append(batch, t)
+			batchSize += len(t)
 			r.txIndex++
+
+			if len(batch) >= r.config.MaxBatchTxs || batchSize >= r.config.MaxBatchSize {
+				flush()
+			}
+		case <-timeoutCh:
+			flush()
 		case <-r.terminate:
 			r.logger.Debug("Raft exiting")
 			return nil
@@ -127,6 +173,104 @@ func (r *Raft) Run() error {
 	}
 }
 
+// propose submits the batches collected by Run to the Raft log, one after the
+// other
+func (r *Raft) propose() {
+	for txs := range r.proposeCh {
+		r.proposeBlock(txs)
+	}
+}
+
+// proposeBlock submits a batch of transactions to the Raft log and waits for it
+// to be applied. If the block index turns out to be taken, because another
+// leader proposed blocks in the meantime, the leader syncs again and retries
+// once.
+func (r *Raft) proposeBlock(txs [][]byte) {
+	for attempt := 0; attempt < 2; attempt++ {
+		err := r.proposeBlockAt(txs)
+		if err == nil {
+			return
+		}
+		r.synced = false
+		if err != errProcessedBlock {
+			r.logger.WithError(err).Error("Proposing Raft block")
+			return
+		}
+	}
+	r.logger.Error("Proposing Raft block: block index taken by another leader")
+}
+
+// proposeBlockAt proposes a batch of transactions as the block at nextIndex
+func (r *Raft) proposeBlockAt(txs [][]byte) error {
+	// the barrier returns once every entry of the log, including those of a
+	// previous leader, has been applied to the State
+	if !r.synced {
+		if err := r.raftNode.Barrier(r.config.CommitTimeout).Error(); err != nil {
+			return fmt.Errorf("syncing with the log: %v", err)
+		}
+		r.nextIndex = r.fsm.state.GetBlockIndex() + 1
+		r.synced = true
+	}
+
+	data, err := newBlockProposal(r.fsm.state.GenesisHash(), r.nextIndex, time.Now().Unix(), txs).Marshal()
+	if err != nil {
+		return fmt.Errorf("encoding block proposal: %v", err)
+	}
+
+	f := r.raftNode.Apply(data, r.config.CommitTimeout)
+	if err := f.Error(); err != nil {
+		return fmt.Errorf("applying Raft block: %v", err)
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+
+	r.nextIndex++
+	return nil
+}
+
+// ReadBarrier implements the read consistency levels offered by the Service.
+// Reads which are not stale can only be served by the leader; followers return
+// an error indicating the address of the current leader.
+//
+// A lease read relies on the leader stepping down when it fails to contact a
+// quorum within LeaderLeaseTimeout. A newly elected leader may not have applied
+// the entries committed by the previous leader yet, so the first lease read of
+// each term waits for a barrier. A linearizable read commits a barrier entry,
+// which confirms leadership with a quorum and returns once every preceding
+// entry has been applied to the State.
+func (r *Raft) ReadBarrier(level service.ReadConsistency) error {
+	if r.raftNode.State() != _raft.Leader {
+		return fmt.Errorf("not the leader, current leader is %q", r.raftNode.Leader())
+	}
+
+	switch level {
+	case service.LeaseRead:
+		return r.leaseBarrier()
+	case service.LinearizableRead:
+		return r.raftNode.Barrier(r.config.CommitTimeout).Error()
+	default:
+		return fmt.Errorf("unsupported read consistency %q", level)
+	}
+}
+
+// leaseBarrier commits a barrier entry the first time it is called in a term
+func (r *Raft) leaseBarrier() error {
+	term := r.raftNode.Stats()["term"]
+
+	r.leaseMutex.Lock()
+	defer r.leaseMutex.Unlock()
+
+	if term == r.leaseTerm {
+		return nil
+	}
+	if err := r.raftNode.Barrier(r.config.CommitTimeout).Error(); err != nil {
+		return err
+	}
+	r.leaseTerm = term
+	return nil
+}
+
 // Info returns Raft stats
 func (r *Raft) Info() (map[string]string, error) {
 	info := r.raftNode.Stats()
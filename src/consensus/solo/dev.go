@@ -0,0 +1,135 @@
+package solo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+/*******************************************************************************
+IMPLEMENT SERVICE DEVBACKEND INTERFACE
+*******************************************************************************/
+
+// devSnapshot records what is needed to revert the chain to a previous point
+type devSnapshot struct {
+	blockIndex    int64
+	root          common.Hash
+	pending       [][]byte
+	timeOffset    int64
+	nextTimestamp int64
+	lastTime      int64
+}
+
+// Mine produces a block with the pending transactions, even if there are none
+func (s *Solo) Mine() error {
+	return s.mine()
+}
+
+// IncreaseTime shifts the timestamp of future blocks by the given number of
+// seconds, and returns the total shift
+func (s *Solo) IncreaseTime(seconds int64) int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	s.timeOffset += seconds
+
+	s.logger.WithField("offset", s.timeOffset).Debug("IncreaseTime")
+
+	return s.timeOffset
+}
+
+// SetNextBlockTimestamp sets the timestamp of the next block. Blocks produced
+// after it carry on from that time.
+func (s *Solo) SetNextBlockTimestamp(timestamp int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if timestamp < s.lastTime {
+		return fmt.Errorf("timestamp %d is lower than the previous block's timestamp %d",
+			timestamp, s.lastTime)
+	}
+
+	s.nextTimestamp = timestamp
+
+	return nil
+}
+
+// Snapshot records the state root, chain head, pending transactions and time
+// settings, and returns the id of the snapshot
+func (s *Solo) Snapshot() (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.snapshotID++
+	s.snapshots[s.snapshotID] = devSnapshot{
+		blockIndex:    s.state.GetBlockIndex(),
+		root:          s.state.GetRoot(),
+		pending:       append([][]byte{}, s.pending...),
+		timeOffset:    s.timeOffset,
+		nextTimestamp: s.nextTimestamp,
+		lastTime:      s.lastTime,
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"id":    s.snapshotID,
+		"block": s.state.GetBlockIndex(),
+	}).Debug("Snapshot")
+
+	return s.snapshotID, nil
+}
+
+// Revert restores the chain as it was when the snapshot was taken. The snapshot
+// and all the ones taken after it are discarded.
+func (s *Solo) Revert(id uint64) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return false, nil
+	}
+
+	if err := s.state.SetHead(snapshot.blockIndex, snapshot.root); err != nil {
+		s.logger.WithError(err).Error("Revert")
+		return false, err
+	}
+
+	for sid := range s.snapshots {
+		if sid >= id {
+			delete(s.snapshots, sid)
+		}
+	}
+
+	s.pending = snapshot.pending
+	s.timeOffset = snapshot.timeOffset
+	s.nextTimestamp = snapshot.nextTimestamp
+	s.lastTime = snapshot.lastTime
+
+	s.logger.WithFields(logrus.Fields{
+		"id":    id,
+		"block": snapshot.blockIndex,
+	}).Debug("Revert")
+
+	return true, nil
+}
+
+// nextBlockTime returns the timestamp of the next block, taking into account
+// the time settings. Timestamps never decrease.
+func (s *Solo) nextBlockTime() int64 {
+	now := time.Now().Unix()
+
+	timestamp := now + s.timeOffset
+	if s.nextTimestamp != 0 {
+		timestamp = s.nextTimestamp
+		s.timeOffset = s.nextTimestamp - now
+		s.nextTimestamp = 0
+	}
+
+	if timestamp < s.lastTime {
+		timestamp = s.lastTime
+	}
+
+	return timestamp
+}
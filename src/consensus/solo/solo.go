@@ -1,14 +1,16 @@
 package solo
 
 import (
-	"fmt"
 	"strconv"
+	"sync"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/sirupsen/logrus"
 
+	"github.com/Fantom-foundation/go-evm/src/config"
 	"github.com/Fantom-foundation/go-evm/src/service"
 	"github.com/Fantom-foundation/go-evm/src/state"
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
 )
 
 /*
@@ -16,16 +18,29 @@ Solo implements the Consensus interface.
 It relays messages directly from the State to the Service.
 */
 type Solo struct {
-	txIndex int
+	config  config.SoloConfig
 	state   *state.State
 	service *service.Service
 	logger  *logrus.Entry
+
+	sync.Mutex
+	txIndex int
+	pending [][]byte
+
+	// dev settings
+	timeOffset    int64
+	nextTimestamp int64
+	lastTime      int64
+	snapshotID    uint64
+	snapshots     map[uint64]devSnapshot
 }
 
 // NewSolo returns a Solo object with nil State and Service
-func NewSolo(logger *logrus.Logger) *Solo {
+func NewSolo(config config.SoloConfig, logger *logrus.Logger) *Solo {
 	return &Solo{
-		logger: logger.WithField("module", "solo"),
+		config:    config,
+		logger:    logger.WithField("module", "solo"),
+		snapshots: make(map[uint64]devSnapshot),
 	}
 }
 
@@ -40,43 +55,85 @@ func (s *Solo) Init(state *state.State, service *service.Service) error {
 
 	s.state = state
 	s.service = service
+	s.service.SetReadBarrierCallback(s.readBarrier)
 
-	return nil
+	return s.service.EnableDevAPI(s)
 }
 
 // Run pipes the Service's submitCh to the States's ProcessBlock function. It
-// wraps individual transactions into Lachesis Blocks
+// wraps transactions into Lachesis Blocks. If BlockTime is set, transactions are
+// collected and a block is produced at every interval, otherwise a block is
+// produced for each transaction (automine).
 func (s *Solo) Run() error {
 	submitCh := s.service.GetSubmitCh()
+
+	var tickCh <-chan time.Time
+	if s.config.BlockTime > 0 {
+		ticker := time.NewTicker(s.config.BlockTime)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
 	for {
 		select {
 		case t := <-submitCh:
 			s.logger.WithField("tx", s.txIndex).Debug("Adding Transaction")
 
-			err := s.state.ApplyTransaction(t,
-				s.txIndex,
-				common.BytesToHash([]byte((fmt.Sprintf("block %d", s.txIndex)))))
-			if err != nil {
-				s.logger.WithField("tx", s.txIndex).WithError(err).Errorf("ApplyTransaction")
-			}
+			s.Lock()
+			s.pending = append(s.pending, t)
+			s.txIndex++
+			s.Unlock()
 
-			hash, err := s.state.Commit()
-			if err != nil {
-				s.logger.WithField("tx", s.txIndex).WithError(err).Errorf("Commit")
+			if s.config.BlockTime == 0 {
+				s.mine()
 			}
+		case <-tickCh:
+			s.mine()
+		}
+	}
+}
 
-			s.logger.WithField("tx", s.txIndex).Debugf("Result State Hash: %v", hash)
+// mine wraps the pending transactions into the next block and processes it
+func (s *Solo) mine() error {
+	s.Lock()
+	defer s.Unlock()
 
-			s.txIndex++
-		}
+	block := poset.NewBlock(s.state.GetBlockIndex()+1, 0, nil, s.pending)
+	block.CreatedTime = s.nextBlockTime()
+
+	hash, err := s.state.ProcessBlock(block)
+	if err != nil {
+		s.logger.WithField("block", block.Index()).WithError(err).Error("ProcessBlock")
+		return err
 	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block": block.Index(),
+		"txs":   len(s.pending),
+	}).Debugf("Result State Hash: %v", hash)
+
+	s.pending = nil
+	s.lastTime = block.CreatedTime
+
+	return nil
 }
 
-// Info returns the current transaction index
+// readBarrier satisfies every read consistency level trivially, because a Solo
+// node is the only authority on the state of the chain.
+func (s *Solo) readBarrier(level service.ReadConsistency) error {
+	return nil
+}
+
+// Info returns the current transaction and block indexes
 func (s *Solo) Info() (map[string]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
 	info := map[string]string{
-		"type":     "solo",
-		"tx_index": strconv.Itoa(s.txIndex),
+		"type":        "solo",
+		"tx_index":    strconv.Itoa(s.txIndex),
+		"block_index": strconv.FormatInt(s.state.GetBlockIndex(), 10),
+		"pending_txs": strconv.Itoa(len(s.pending)),
 	}
 	return info, nil
 }
@@ -0,0 +1,206 @@
+package solo
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+	"github.com/Fantom-foundation/go-evm/src/config"
+	"github.com/Fantom-foundation/go-evm/src/service"
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+func newTestSolo(t *testing.T, blockTime time.Duration) *Solo {
+	logger := bcommon.NewTestLogger(t)
+
+	db, err := state.NewDatabase(state.MemoryBackend, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := state.NewState(logger, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.InitGenesis(state.DefaultGenesis()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := service.NewService("", "", "", "stale", "", nil, 0, st, make(chan []byte), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSolo(config.SoloConfig{BlockTime: blockTime}, logger)
+	if err := s.Init(st, srv); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// waitFor polls a condition until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAutomine(t *testing.T) {
+	s := newTestSolo(t, 0)
+	defer s.state.Close()
+	go s.Run()
+
+	submitCh := s.service.GetSubmitCh()
+	for i := int64(1); i <= 2; i++ {
+		submitCh <- []byte("tx" + strconv.FormatInt(i, 10))
+		waitFor(t, "block "+strconv.FormatInt(i, 10), func() bool {
+			return s.state.GetBlockIndex() == i
+		})
+
+		block, err := s.state.GetBlockById(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Transactions()) != 1 {
+			t.Fatalf("block %d should have 1 transaction, not %d", i, len(block.Transactions()))
+		}
+	}
+}
+
+func TestBlockTime(t *testing.T) {
+	// The interval is long enough for blocks to only be produced by Mine
+	s := newTestSolo(t, time.Hour)
+	defer s.state.Close()
+	go s.Run()
+
+	submitCh := s.service.GetSubmitCh()
+	submitCh <- []byte("tx1")
+	submitCh <- []byte("tx2")
+	waitFor(t, "pending transactions", func() bool {
+		info, _ := s.Info()
+		return info["pending_txs"] == "2"
+	})
+	if s.state.GetBlockIndex() != 0 {
+		t.Fatal("transactions should wait for the next block")
+	}
+
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	block, err := s.state.GetBlockById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions()) != 2 {
+		t.Fatalf("block should collect 2 transactions, not %d", len(block.Transactions()))
+	}
+
+	// Empty blocks can be forced too
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	if s.state.GetBlockIndex() != 2 {
+		t.Fatalf("block index should be 2, not %d", s.state.GetBlockIndex())
+	}
+}
+
+func TestDevTime(t *testing.T) {
+	s := newTestSolo(t, time.Hour)
+	defer s.state.Close()
+
+	blockTime := func(index int64) int64 {
+		block, err := s.state.GetBlockById(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return block.CreatedTime
+	}
+
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	first := blockTime(1)
+
+	if offset := s.IncreaseTime(3600); offset != 3600 {
+		t.Fatalf("offset should be 3600, not %d", offset)
+	}
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	if blockTime(2) < first+3600 {
+		t.Fatalf("block time should be shifted by an hour, not %d", blockTime(2)-first)
+	}
+
+	if err := s.SetNextBlockTimestamp(first); err == nil {
+		t.Fatal("timestamps should not go back")
+	}
+	next := blockTime(2) + 1000
+	if err := s.SetNextBlockTimestamp(next); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	if blockTime(3) != next {
+		t.Fatalf("block time should be %d, not %d", next, blockTime(3))
+	}
+
+	// Later blocks carry on from that time
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	if blockTime(4) < next {
+		t.Fatalf("block time should not go back to %d", blockTime(4))
+	}
+}
+
+func TestDevSnapshotRevert(t *testing.T) {
+	s := newTestSolo(t, time.Hour)
+	defer s.state.Close()
+
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	root := s.state.GetRoot()
+
+	id, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.IncreaseTime(3600)
+	for i := 0; i < 2; i++ {
+		if err := s.Mine(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ok, err := s.Revert(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("snapshot should be reverted")
+	}
+	if s.state.GetBlockIndex() != 1 || s.state.GetRoot() != root {
+		t.Fatalf("chain should be back at block 1, not %d", s.state.GetBlockIndex())
+	}
+	if s.timeOffset != 0 {
+		t.Fatalf("time offset should be reverted, not %d", s.timeOffset)
+	}
+
+	// A snapshot can only be reverted once
+	if ok, err := s.Revert(id); err != nil || ok {
+		t.Fatal("a reverted snapshot should be discarded")
+	}
+
+	// Blocks are produced again after the reverted head
+	if err := s.Mine(); err != nil {
+		t.Fatal(err)
+	}
+	if s.state.GetBlockIndex() != 2 {
+		t.Fatalf("block index should be 2, not %d", s.state.GetBlockIndex())
+	}
+}
@@ -22,20 +22,24 @@ func NewConsensusEngine(config config.Config,
 	logger *logrus.Logger) (*ConsensusEngine, error) {
 	submitCh := make(chan []byte)
 
-	state, err := state.NewState(logger,
-		config.Eth.DbFile,
-		config.Eth.Cache)
+	state, err := newState(config.Eth, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	service := service.NewService(config.Eth.Genesis,
-		config.Eth.Keystore,
+	service, err := service.NewService(config.Eth.Keystore,
 		config.Eth.EthAPIAddr,
 		config.Eth.PwdFile,
+		config.Eth.ReadConsistency,
+		config.Eth.Signer,
+		config.Eth.Locked,
+		config.Eth.UnlockDuration,
 		state,
 		submitCh,
 		logger)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := consensus.Init(state, service); err != nil {
 		return nil, err
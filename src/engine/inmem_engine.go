@@ -2,7 +2,7 @@ package engine
 
 import (
 	"fmt"
-	//"os"
+	"os"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -14,6 +14,7 @@ import (
 	"github.com/Fantom-foundation/go-lachesis/src/net"
 	"github.com/Fantom-foundation/go-lachesis/src/node"
 	"github.com/Fantom-foundation/go-lachesis/src/peers"
+	"github.com/Fantom-foundation/go-lachesis/src/pos"
 	"github.com/Fantom-foundation/go-lachesis/src/poset"
 	serv "github.com/Fantom-foundation/go-lachesis/src/service"
 )
@@ -28,20 +29,24 @@ type InmemEngine struct {
 func NewInmemEngine(config config.Config, logger *logrus.Logger) (*InmemEngine, error) {
 	submitCh := make(chan []byte)
 
-	state, err := state.NewState(logger,
-		config.Eth.DbFile,
-		config.Eth.Cache)
+	state, err := newState(config.Eth, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	service := service.NewService(config.Eth.Genesis,
-		config.Eth.Keystore,
+	service, err := service.NewService(config.Eth.Keystore,
 		config.Eth.EthAPIAddr,
 		config.Eth.PwdFile,
+		config.Eth.ReadConsistency,
+		config.Eth.Signer,
+		config.Eth.Locked,
+		config.Eth.UnlockDuration,
 		state,
 		submitCh,
 		logger)
+	if err != nil {
+		return nil, err
+	}
 
 	appProxy := NewInmemProxy(state, service, submitCh, logger)
 
@@ -94,32 +99,10 @@ func NewInmemEngine(config config.Config, logger *logrus.Logger) (*InmemEngine,
 		logger)
 
 	//Instantiate the Store (inmem or badger)
-	var store poset.Store
-	//var needBootstrap bool
-	/* TODO inmem only for now */
-	/*switch conf.StoreType {
-	case "inmem":*/
-	store = poset.NewInmemStore(pmap, conf.CacheSize)
-	/*case "badger":
-		//If the file already exists, load and bootstrap the store using the file
-		if _, err := os.Stat(conf.StorePath); err == nil {
-			logger.Debug("loading badger store from existing database")
-			store, err = poset.LoadBadgerStore(conf.CacheSize, conf.StorePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load BadgerStore from existing file: %s", err)
-			}
-			needBootstrap = true
-		} else {
-			//Otherwise create a new one
-			logger.Debug("creating new badger store from fresh database")
-			store, err = poset.NewBadgerStore(pmap, conf.CacheSize, conf.StorePath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create new BadgerStore: %s", err)
-			}
-		}
-	default:
-		return nil, fmt.Errorf("Invalid StoreType: %s", conf.StoreType)
-	}*/
+	store, err := newStore(config.Lachesis, pmap, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	trans, err := net.NewTCPTransport(
 		config.Lachesis.BindAddr, nil, 2, conf.TCPTimeout, logger)
@@ -143,6 +126,35 @@ func NewInmemEngine(config config.Config, logger *logrus.Logger) (*InmemEngine,
 
 }
 
+//newStore creates the poset Store. With a persistent store, a node restarting
+//on an existing database is bootstrapped from it by node.Init, instead of
+//resyncing the whole DAG from its peers.
+func newStore(config *config.LachesisConfig, participants *peers.Peers, logger *logrus.Logger) (poset.Store, error) {
+	if !config.Store {
+		return poset.NewInmemStore(participants, config.CacheSize, pos.DefaultConfig()), nil
+	}
+
+	dbDir := config.BadgerDir()
+
+	//If the database already exists, load and bootstrap the store from it
+	if _, err := os.Stat(dbDir); err == nil {
+		logger.WithField("path", dbDir).Debug("loading badger store from existing database")
+		store, err := poset.LoadBadgerStore(config.CacheSize, dbDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load BadgerStore from existing file: %s", err)
+		}
+		return store, nil
+	}
+
+	//Otherwise create a new one
+	logger.WithField("path", dbDir).Debug("creating new badger store from fresh database")
+	store, err := poset.NewBadgerStore(participants, config.CacheSize, dbDir, pos.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new BadgerStore: %s", err)
+	}
+	return store, nil
+}
+
 /*******************************************************************************
 Implement Engine interface
 *******************************************************************************/
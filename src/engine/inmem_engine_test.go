@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+	"github.com/Fantom-foundation/go-evm/src/config"
+	"github.com/Fantom-foundation/go-lachesis/src/peers"
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+func TestNewStore(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "evm-lachesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	logger := bcommon.NewTestLogger(t)
+	participants := peers.NewPeersFromSlice([]*peers.Peer{
+		peers.NewPeer("0xAA", ""),
+		peers.NewPeer("0xBB", ""),
+	})
+
+	conf := config.DefaultLachesisConfig()
+	conf.SetDataDir(dataDir)
+
+	store, err := newStore(conf, participants, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*poset.InmemStore); !ok {
+		t.Fatalf("store should be in memory by default, not %T", store)
+	}
+
+	// A persistent store is created, then loaded on restart
+	conf.Store = true
+	store, err = newStore(conf, participants, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*poset.BadgerStore); !ok {
+		t.Fatalf("store should be persistent, not %T", store)
+	}
+	if store.NeedBoostrap() {
+		t.Fatal("a new store has nothing to bootstrap from")
+	}
+	if _, err := os.Stat(conf.BadgerDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newStore(conf, participants, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if !store.NeedBoostrap() {
+		t.Fatal("an existing store should be bootstrapped from")
+	}
+	loaded, err := store.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != participants.Len() {
+		t.Fatalf("store should be loaded with %d participants, not %d",
+			participants.Len(), loaded.Len())
+	}
+}
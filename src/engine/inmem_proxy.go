@@ -47,15 +47,20 @@ func (i *InmemProxy) SubmitInternalCh() chan poset.InternalTransaction {
 //CommitBlock commits Block to the State and expects the resulting state hash
 func (i *InmemProxy) CommitBlock(block poset.Block) ([]byte, error) {
 	i.logger.Debug("CommitBlock")
-	stateHash, err := i.state.ProcessBlock(block)
+	stateHash, err := i.state.ProcessLachesisBlock(block)
 	return stateHash.Bytes(), err
 }
 
-//TODO - Implement these two functions
+//GetSnapshot returns a snapshot of the State after the block with the given
+//index
 func (i *InmemProxy) GetSnapshot(blockIndex int64) ([]byte, error) {
-	return []byte{}, nil
+	i.logger.WithField("block", blockIndex).Debug("GetSnapshot")
+	return i.state.GetLachesisSnapshot(blockIndex)
 }
 
+//Restore resets the State from a snapshot
 func (i *InmemProxy) Restore(snapshot []byte) error {
-	return nil
+	i.logger.Debug("Restore")
+	_, err := i.state.Restore(snapshot)
+	return err
 }
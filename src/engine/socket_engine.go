@@ -21,20 +21,24 @@ type SocketEngine struct {
 func NewSocketEngine(config config.Config, logger *logrus.Logger) (*SocketEngine, error) {
 	submitCh := make(chan []byte)
 
-	state, err := state.NewState(logger,
-		config.Eth.DbFile,
-		config.Eth.Cache)
+	state, err := newState(config.Eth, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	service := service.NewService(config.Eth.Genesis,
-		config.Eth.Keystore,
+	service, err := service.NewService(config.Eth.Keystore,
 		config.Eth.EthAPIAddr,
 		config.Eth.PwdFile,
+		config.Eth.ReadConsistency,
+		config.Eth.Signer,
+		config.Eth.Locked,
+		config.Eth.UnlockDuration,
 		state,
 		submitCh,
 		logger)
+	if err != nil {
+		return nil, err
+	}
 
 	logger.WithFields(logrus.Fields{
 		"config": config}).Debug("NewSocketEngine")
@@ -64,7 +68,7 @@ func (s *SocketEngine) serve() {
 			s.logger.Debug("proxy submitted tx")
 		case commit := <-s.proxy.CommitCh():
 			s.logger.Debug("CommitBlock")
-			stateHash, err := s.state.ProcessBlock(commit.Block)
+			stateHash, err := s.state.ProcessLachesisBlock(commit.Block)
 			commit.Respond(stateHash.Bytes(), err)
 		}
 	}
@@ -88,18 +92,29 @@ func (h *Handler) CommitHandler(block poset.Block) (stateHash []byte, err error)
 	  h.stateHash = hash
 
 	  return h.stateHash, nil*/
-	hash, err := h.state.ProcessBlock(block)
-	return hash.Bytes(), nil
+	hash, err := h.state.ProcessLachesisBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	h.stateHash = hash.Bytes()
+	return h.stateHash, nil
 }
 
-// Called when syncing with the network
+// Called when syncing with the network. Returns a snapshot of the State after
+// the block with the given index.
 func (h *Handler) SnapshotHandler(blockIndex int) (snapshot []byte, err error) {
-	return []byte{}, nil
+	return h.state.GetLachesisSnapshot(int64(blockIndex))
 }
 
-// Called when syncing with the network
+// Called when syncing with the network. Resets the State from a snapshot and
+// returns the verified state hash.
 func (h *Handler) RestoreHandler(snapshot []byte) (stateHash []byte, err error) {
-	return []byte{}, nil
+	hash, err := h.state.Restore(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	h.stateHash = hash.Bytes()
+	return h.stateHash, nil
 }
 
 func NewHandler(state *state.State) *Handler {
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Fantom-foundation/go-evm/src/config"
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+// newState opens the database and sets up the State with the genesis file and
+// the options of the configuration. If the configuration gives the genesis hash
+// of the network, the genesis file must match it.
+func newState(config *config.EthConfig, logger *logrus.Logger) (*state.State, error) {
+	genesis, err := state.LoadGenesis(config.Genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := state.NewDatabase(config.DbBackend,
+		config.DbFile,
+		config.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := state.NewState(logger,
+		db,
+		config.StateDiffs,
+		config.Preimages)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.InitGenesis(genesis)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if config.GenesisHash != "" && common.HexToHash(config.GenesisHash) != hash {
+		s.Close()
+		return nil, fmt.Errorf("genesis mismatch: network genesis is %s, not %s",
+			common.HexToHash(config.GenesisHash).Hex(), hash.Hex())
+	}
+
+	for _, trusted := range config.TrustedRoots {
+		blockIndex, root, err := parseTrustedRoot(trusted)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.TrustBlockRoot(blockIndex, root)
+	}
+
+	if config.Pruned() {
+		s.EnablePruning(config.TrieRoots, config.Cache, config.TrieFlush)
+	}
+
+	if config.Verify {
+		if err := s.CheckIntegrity(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// parseTrustedRoot parses a trusted state root given as "<block>:<root>"
+func parseTrustedRoot(trusted string) (int64, common.Hash, error) {
+	parts := strings.Split(trusted, ":")
+	if len(parts) != 2 {
+		return 0, common.Hash{}, fmt.Errorf("invalid trusted root %q, expected <block>:<root>", trusted)
+	}
+	blockIndex, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, common.Hash{}, fmt.Errorf("invalid block of trusted root %q: %v", trusted, err)
+	}
+	root, err := hexutil.Decode(parts[1])
+	if err != nil || len(root) != common.HashLength {
+		return 0, common.Hash{}, fmt.Errorf("invalid root of trusted root %q", trusted)
+	}
+	return blockIndex, common.BytesToHash(root), nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ReadConsistency is the level of consistency requested for a read. It tells
+// the Service what to wait for, or check, before answering from its local
+// State.
+type ReadConsistency string
+
+const (
+	// StaleRead serves the read from whatever the local State has applied.
+	StaleRead ReadConsistency = "stale"
+
+	// LeaseRead serves the read only if the node currently holds the
+	// leadership lease. It avoids a round-trip to the quorum but relies on
+	// bounded clock drift.
+	LeaseRead ReadConsistency = "lease"
+
+	// LinearizableRead confirms leadership with a quorum, and waits until every
+	// committed entry has been applied to the local State, before serving the
+	// read. The read is guaranteed to observe all writes that completed before
+	// it started.
+	LinearizableRead ReadConsistency = "linearizable"
+)
+
+// ReadConsistencyHeader is the HTTP header with which clients of the REST API
+// can override the default read consistency level on a per-request basis.
+const ReadConsistencyHeader = "X-Read-Consistency"
+
+// ParseReadConsistency converts a string into a ReadConsistency level
+func ParseReadConsistency(level string) (ReadConsistency, error) {
+	switch l := ReadConsistency(level); l {
+	case StaleRead, LeaseRead, LinearizableRead:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unknown read consistency level %q (expected %s, %s or %s)",
+			level, StaleRead, LeaseRead, LinearizableRead)
+	}
+}
+
+// readBarrierCallback is provided by the consensus system. It blocks until the
+// local State satisfies the requested consistency level, or returns an error if
+// it cannot (ex: the node is not the leader).
+type readBarrierCallback func(level ReadConsistency) error
+
+// SetReadBarrierCallback registers the function used to satisfy read
+// consistency levels other than StaleRead.
+func (m *Service) SetReadBarrierCallback(f readBarrierCallback) {
+	m.readBarrier = f
+}
+
+// resolveReadConsistency parses the requested consistency level, falling back
+// to the configured default when none is specified.
+func (m *Service) resolveReadConsistency(level string) (ReadConsistency, error) {
+	if level == "" {
+		return m.readConsistency, nil
+	}
+	return ParseReadConsistency(level)
+}
+
+// waitForRead waits for the consensus system to satisfy the given consistency
+// level.
+func (m *Service) waitForRead(level ReadConsistency) error {
+	if level == StaleRead {
+		return nil
+	}
+
+	if m.readBarrier == nil {
+		return fmt.Errorf("read consistency %q not supported by the consensus system", level)
+	}
+
+	return m.readBarrier(level)
+}
+
+// waitForRPCRead is the equivalent of waitForRead for the optional consistency
+// parameter of RPC methods
+func (m *Service) waitForRPCRead(level *string) error {
+	var requested string
+	if level != nil {
+		requested = *level
+	}
+
+	l, err := m.resolveReadConsistency(requested)
+	if err != nil {
+		return err
+	}
+
+	return m.waitForRead(l)
+}
+
+// makeReadHandler wraps a handler which reads from the State, such that the
+// read consistency level requested in the ReadConsistencyHeader (or the default
+// one) is satisfied before the handler is invoked. The barrier is waited for
+// outside of the Service lock so that it doesn't hold up other requests.
+func (m *Service) makeReadHandler(fn func(http.ResponseWriter, *http.Request, *Service)) http.HandlerFunc {
+	handler := m.makeHandler(fn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		level, err := m.resolveReadConsistency(r.Header.Get(ReadConsistencyHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := m.waitForRead(level); err != nil {
+			m.logger.WithError(err).Debug("Read barrier")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+)
+
+func newConsistencyService(t *testing.T, level ReadConsistency, requested *[]ReadConsistency) *Service {
+	s := &Service{
+		logger:          bcommon.NewTestLogger(t),
+		readConsistency: level,
+	}
+	s.SetReadBarrierCallback(func(l ReadConsistency) error {
+		*requested = append(*requested, l)
+		if l == LeaseRead {
+			return errors.New("not the leader")
+		}
+		return nil
+	})
+	return s
+}
+
+func TestParseReadConsistency(t *testing.T) {
+	for _, level := range []string{"stale", "lease", "linearizable"} {
+		l, err := ParseReadConsistency(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(l) != level {
+			t.Fatalf("%q should be parsed as itself, not %q", level, l)
+		}
+	}
+
+	if _, err := ParseReadConsistency("strong"); err == nil {
+		t.Fatal("an unknown level should be refused")
+	}
+}
+
+func TestNewServiceInvalidConsistency(t *testing.T) {
+	s, err := NewService("", "", "", "strong", "", nil, 0, nil, nil, bcommon.NewTestLogger(t))
+	if err == nil || s != nil {
+		t.Fatal("an invalid default read consistency should be an error")
+	}
+}
+
+func TestRPCReadConsistency(t *testing.T) {
+	var requested []ReadConsistency
+	s := newConsistencyService(t, LinearizableRead, &requested)
+
+	// The default level applies when none is requested
+	if err := s.waitForRPCRead(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A per-request level overrides it
+	stale := string(StaleRead)
+	if err := s.waitForRPCRead(&stale); err != nil {
+		t.Fatal(err)
+	}
+	lease := string(LeaseRead)
+	if err := s.waitForRPCRead(&lease); err == nil {
+		t.Fatal("the barrier error should be returned")
+	}
+	strong := "strong"
+	if err := s.waitForRPCRead(&strong); err == nil {
+		t.Fatal("an unknown level should be refused")
+	}
+
+	expected := []ReadConsistency{LinearizableRead, LeaseRead}
+	if len(requested) != len(expected) {
+		t.Fatalf("barrier should be called for %v, not %v", expected, requested)
+	}
+	for i, l := range expected {
+		if requested[i] != l {
+			t.Fatalf("barrier should be called for %v, not %v", expected, requested)
+		}
+	}
+}
+
+func TestRPCReadConsistencyUnsupported(t *testing.T) {
+	s := &Service{readConsistency: StaleRead}
+
+	if err := s.waitForRPCRead(nil); err != nil {
+		t.Fatal(err)
+	}
+	linearizable := string(LinearizableRead)
+	if err := s.waitForRPCRead(&linearizable); err == nil {
+		t.Fatal("non-stale reads need a consensus system which supports them")
+	}
+}
+
+func TestReadHandlerConsistency(t *testing.T) {
+	var requested []ReadConsistency
+	s := newConsistencyService(t, StaleRead, &requested)
+
+	handler := s.makeReadHandler(func(w http.ResponseWriter, r *http.Request, m *Service) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"linearizable", http.StatusOK},
+		{"lease", http.StatusServiceUnavailable},
+		{"strong", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/accounts", nil)
+		if c.header != "" {
+			req.Header.Set(ReadConsistencyHeader, c.header)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != c.status {
+			t.Fatalf("%s %q should answer %d, not %d", ReadConsistencyHeader, c.header, c.status, rec.Code)
+		}
+	}
+
+	if len(requested) != 2 {
+		t.Fatalf("barrier should only be called for non-stale reads, not %v", requested)
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ExternalSignerScheme is the URL scheme of the external signer wallet
+const ExternalSignerScheme = "extapi"
+
+// externalSignerTimeout bounds the requests to the external signer. It is long
+// because the signer may wait for a user to approve a request.
+const externalSignerTimeout = 5 * time.Minute
+
+var errExternalSignerHash = errors.New("the external signer does not sign raw hashes")
+
+// ExternalSigner is an accounts.Backend whose keys live in a separate process,
+// reached over a Unix socket or a loopback JSON-RPC endpoint. The signer
+// approves and signs transactions itself, with the account_list and
+// account_signTransaction methods of the Clef API, so no key is ever held by
+// the node.
+type ExternalSigner struct {
+	endpoint string
+	client   *rpc.Client
+	feed     event.Feed
+
+	mu       sync.RWMutex
+	accounts []accounts.Account
+}
+
+// NewExternalSigner connects to an external signer and lists its accounts.
+// The endpoint is the path of a Unix socket, or an http or ws URL whose host
+// must be a loopback address.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(u.Hostname())
+		if u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("external signer %s is not on a loopback address", endpoint)
+		}
+	}
+
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to external signer %s: %v", endpoint, err)
+	}
+
+	s := &ExternalSigner{
+		endpoint: endpoint,
+		client:   client,
+	}
+	if err := s.refresh(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// refresh fetches the list of accounts of the signer. It is cached, as the
+// signer may ask a user to approve every listing.
+func (s *ExternalSigner) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), externalSignerTimeout)
+	defer cancel()
+
+	var addresses []common.Address
+	if err := s.client.CallContext(ctx, &addresses, "account_list"); err != nil {
+		return fmt.Errorf("listing accounts of external signer: %v", err)
+	}
+
+	accs := make([]accounts.Account, len(addresses))
+	for i, address := range addresses {
+		accs[i] = accounts.Account{
+			Address: address,
+			URL:     accounts.URL{Scheme: ExternalSignerScheme, Path: s.endpoint},
+		}
+	}
+
+	s.mu.Lock()
+	s.accounts = accs
+	s.mu.Unlock()
+	return nil
+}
+
+/*******************************************************************************
+IMPLEMENT ACCOUNTS.BACKEND INTERFACE
+*******************************************************************************/
+
+// Wallets returns the single wallet of the signer
+func (s *ExternalSigner) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{s}
+}
+
+// Subscribe registers a subscriber for wallet events. The wallet of the signer
+// never changes, so no event is sent.
+func (s *ExternalSigner) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return s.feed.Subscribe(sink)
+}
+
+/*******************************************************************************
+IMPLEMENT ACCOUNTS.WALLET INTERFACE
+*******************************************************************************/
+
+// URL returns the endpoint of the signer
+func (s *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: ExternalSignerScheme, Path: s.endpoint}
+}
+
+// Status refreshes the accounts of the signer, which tells whether it is
+// reachable
+func (s *ExternalSigner) Status() (string, error) {
+	if err := s.refresh(); err != nil {
+		return "Unreachable", err
+	}
+	return "Ok", nil
+}
+
+// Open does nothing, the connection is opened by NewExternalSigner
+func (s *ExternalSigner) Open(passphrase string) error {
+	return nil
+}
+
+// Close closes the connection to the signer
+func (s *ExternalSigner) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// Accounts returns the accounts of the signer
+func (s *ExternalSigner) Accounts() []accounts.Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]accounts.Account{}, s.accounts...)
+}
+
+// Contains reports whether an account is one of the signer
+func (s *ExternalSigner) Contains(account accounts.Account) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.accounts {
+		if a.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == a.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive is not supported by the signer
+func (s *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive is not supported by the signer
+func (s *ExternalSigner) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {
+}
+
+// SignHash is not supported: the signer only signs what it can show to the
+// user approving the request
+func (s *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, errExternalSignerHash
+}
+
+// SignHashWithPassphrase is not supported either
+func (s *ExternalSigner) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, errExternalSignerHash
+}
+
+// externalSignerTxArgs are the arguments of account_signTransaction
+type externalSignerTxArgs struct {
+	From     common.MixedcaseAddress  `json:"from"`
+	To       *common.MixedcaseAddress `json:"to"`
+	Gas      hexutil.Uint64           `json:"gas"`
+	GasPrice hexutil.Big              `json:"gasPrice"`
+	Value    hexutil.Big              `json:"value"`
+	Nonce    hexutil.Uint64           `json:"nonce"`
+	Data     *hexutil.Bytes           `json:"data"`
+}
+
+// SignTx asks the signer to approve and sign a transaction. The signer signs
+// for the chain ID it is configured with, which must match the chain's.
+func (s *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if !s.Contains(account) {
+		return nil, accounts.ErrUnknownAccount
+	}
+
+	data := hexutil.Bytes(tx.Data())
+	args := externalSignerTxArgs{
+		From:     common.NewMixedcaseAddress(account.Address),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     &data,
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), externalSignerTimeout)
+	defer cancel()
+
+	var res struct {
+		Raw hexutil.Bytes `json:"raw"`
+	}
+	if err := s.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+
+	signed := new(types.Transaction)
+	if err := rlp.DecodeBytes(res.Raw, signed); err != nil {
+		return nil, err
+	}
+
+	// the signer could have signed something else than what was requested
+	if signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() ||
+		signed.GasPrice().Cmp(tx.GasPrice()) != 0 || signed.Value().Cmp(tx.Value()) != 0 ||
+		!bytes.Equal(signed.Data(), tx.Data()) ||
+		(signed.To() == nil) != (tx.To() == nil) || (tx.To() != nil && *signed.To() != *tx.To()) {
+		return nil, errors.New("external signer returned a different transaction")
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), signed)
+	if err != nil {
+		return nil, fmt.Errorf("external signer did not sign for chain %v: %v", chainID, err)
+	}
+	if sender != account.Address {
+		return nil, fmt.Errorf("external signer signed as %s instead of %s", sender.Hex(), account.Address.Hex())
+	}
+
+	return signed, nil
+}
+
+// SignTxWithPassphrase signs a transaction like SignTx. The passphrase is not
+// used, the signer asks for its own approval.
+func (s *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return s.SignTx(account, tx, chainID)
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+)
+
+// FakeSigner serves the account namespace of an external signer, signing with
+// a single key. It can be made to misbehave.
+type FakeSigner struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	// nonceShift is added to the nonce of the transactions it signs
+	nonceShift uint64
+}
+
+// List returns the address of the key
+func (f *FakeSigner) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(f.key.PublicKey)}
+}
+
+// FakeSignerTxArgs are the arguments of account_signTransaction. RPC arguments
+// must be of exported types.
+type FakeSignerTxArgs externalSignerTxArgs
+
+// SignTransaction signs a transaction with the key
+func (f *FakeSigner) SignTransaction(args FakeSignerTxArgs) (map[string]hexutil.Bytes, error) {
+	var data []byte
+	if args.Data != nil {
+		data = *args.Data
+	}
+	nonce := uint64(args.Nonce) + f.nonceShift
+	var tx *types.Transaction
+	if args.To == nil {
+		tx = types.NewContractCreation(nonce, args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), data)
+	} else {
+		tx = types.NewTransaction(nonce, args.To.Address(), args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), data)
+	}
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(f.chainID), f.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]hexutil.Bytes{"raw": raw}, nil
+}
+
+// startFakeSigner serves a FakeSigner on a Unix socket of dir, and returns the
+// path of the socket
+func startFakeSigner(t *testing.T, dir string, signer *FakeSigner) (string, func()) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", signer); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := filepath.Join(dir, "signer.ipc")
+	l, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeListener(l)
+	return endpoint, func() {
+		l.Close()
+		server.Stop()
+	}
+}
+
+func TestExternalSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &FakeSigner{key: key, chainID: big.NewInt(1)}
+	endpoint, stop := startFakeSigner(t, dir, fake)
+	defer stop()
+
+	signer, err := NewExternalSigner(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	accs := signer.Accounts()
+	if len(accs) != 1 || accs[0].Address != address || accs[0].URL.Scheme != ExternalSignerScheme {
+		t.Fatalf("signer should list %s, not %v", address.Hex(), accs)
+	}
+	if status, err := signer.Status(); err != nil {
+		t.Fatalf("signer should be reachable, not %s: %v", status, err)
+	}
+
+	to := common.HexToAddress("0x01")
+	tx := types.NewTransaction(3, to, big.NewInt(1000), 21000, big.NewInt(1), []byte{0x01})
+
+	signed, err := signer.SignTx(accs[0], tx, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Hash() == tx.Hash() || signed.Nonce() != 3 || *signed.To() != to {
+		t.Fatal("the requested transaction should be signed")
+	}
+	if sender, err := types.Sender(types.NewEIP155Signer(big.NewInt(1)), signed); err != nil || sender != address {
+		t.Fatalf("transaction should be signed by %s", address.Hex())
+	}
+
+	// The signer is only trusted with what it can show the user
+	if _, err := signer.SignHash(accs[0], make([]byte, 32)); err == nil {
+		t.Fatal("raw hashes should not be signed")
+	}
+	unknown := accounts.Account{Address: common.HexToAddress("0x02")}
+	if _, err := signer.SignTx(unknown, tx, big.NewInt(1)); err != accounts.ErrUnknownAccount {
+		t.Fatalf("an unknown account should be refused, not %v", err)
+	}
+
+	// What it returns is checked
+	if _, err := signer.SignTx(accs[0], tx, big.NewInt(2)); err == nil {
+		t.Fatal("a signature for another chain should be refused")
+	}
+	fake.nonceShift = 1
+	if _, err := signer.SignTx(accs[0], tx, big.NewInt(1)); err == nil {
+		t.Fatal("a different transaction should be refused")
+	}
+}
+
+func TestExternalSignerEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"http://10.0.0.1:8550", "http://signer.example.com:8550"} {
+		if _, err := NewExternalSigner(endpoint); err == nil {
+			t.Fatalf("%s is not a loopback address and should be refused", endpoint)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "evm-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := NewExternalSigner(filepath.Join(dir, "missing.ipc")); err == nil {
+		t.Fatal("an unreachable signer should be an error")
+	}
+}
+
+func TestServiceExternalSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint, stop := startFakeSigner(t, dir, &FakeSigner{key: key, chainID: big.NewInt(1)})
+	defer stop()
+
+	// With a signer, no key is loaded from the keystore
+	keystoreDir := filepath.Join(dir, "keystore")
+	newTestKeystore(t, keystoreDir, "one")
+	s := &Service{
+		keystoreDir: keystoreDir,
+		pwdFile:     writePwdFile(t, dir, "one\n"),
+		signer:      endpoint,
+		logger:      bcommon.NewTestLogger(t),
+	}
+	if err := s.makeKeyStore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.unlockAccounts(); err != nil {
+		t.Fatal(err)
+	}
+	if s.keyStore != nil {
+		t.Fatal("the keystore should not be opened")
+	}
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	wallet, err := s.AccountManager().Find(accounts.Account{Address: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := wallet.(*ExternalSigner); !ok {
+		t.Fatalf("accounts should be signed for by the external signer, not %T", wallet)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"strconv"
 
 	"github.com/ethereum/go-ethereum/accounts"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
@@ -117,8 +116,7 @@ func blockByHashHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 			}
 			tx = txFailed.GetTx()
 
-			signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-			from, err := ethTypes.Sender(signer, tx)
+			from, err := m.state.Sender(tx)
 			if err != nil {
 				m.logger.WithError(err).Error("Getting Tx Sender")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -138,8 +136,7 @@ func blockByHashHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 
 		} else {
 
-			signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-			from, err := ethTypes.Sender(signer, tx)
+			from, err := m.state.Sender(tx)
 			if err != nil {
 				m.logger.WithError(err).Error("Getting Tx Sender")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -166,12 +163,15 @@ func blockByHashHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 				ContractAddress:   receipt.ContractAddress,
 				Logs:              receipt.Logs,
 				LogsBloom:         receipt.Bloom,
-				Failed:            false,
+				Failed:            receipt.Status == ethTypes.ReceiptStatusFailed,
 			}
 
 			if receipt.Logs == nil {
 				jsonReceipt.Logs = []*ethTypes.Log{}
 			}
+			if txFailed, err := m.state.GetFailedTx(txHash); err == nil {
+				jsonReceipt.Error = txFailed.GetError()
+			}
 		}
 		jsBlock.Transactions = append(jsBlock.Transactions, jsonReceipt)
 	}
@@ -191,6 +191,47 @@ func blockByHashHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 	}
 }
 
+/*
+GET /stateDiff/{id}
+example: /stateDiff/12
+returns: JSON state.StateDiff
+
+This endpoint returns the accounts and storage slots changed by the block with
+the given index, with their values before and after it. State diffs are only
+recorded when enabled with --eth.state-diffs.
+*/
+func stateDiffHandler(w http.ResponseWriter, r *http.Request, m *Service) {
+	param := r.URL.Path[len("/stateDiff/"):]
+	m.logger.WithField("param", param).Debug("GET stateDiff")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		m.logger.WithError(err).Errorf("Parsing block_index parameter %s", param)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diff, err := m.state.GetStateDiff(id)
+	if err != nil {
+		m.logger.WithError(err).Error("m.state.GetStateDiff(id)")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	js, err := json.Marshal(diff)
+	if err != nil {
+		m.logger.WithError(err).Error("Marshaling JSON response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(js); err != nil {
+		m.logger.WithError(err).Error("Writing JSON response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 /*
 GET /blockById/{id}
 example: /block/0x50bd8a037442af4cdf631495bcaa5443de19685d
@@ -253,8 +294,7 @@ func blockByIdHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 			}
 			tx = txFailed.GetTx()
 
-			signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-			from, err := ethTypes.Sender(signer, tx)
+			from, err := m.state.Sender(tx)
 			if err != nil {
 				m.logger.WithError(err).Error("Getting Tx Sender")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -274,8 +314,7 @@ func blockByIdHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 
 		} else {
 
-			signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-			from, err := ethTypes.Sender(signer, tx)
+			from, err := m.state.Sender(tx)
 			if err != nil {
 				m.logger.WithError(err).Error("Getting Tx Sender")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -302,12 +341,15 @@ func blockByIdHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 				ContractAddress:   receipt.ContractAddress,
 				Logs:              receipt.Logs,
 				LogsBloom:         receipt.Bloom,
-				Failed:            false,
+				Failed:            receipt.Status == ethTypes.ReceiptStatusFailed,
 			}
 
 			if receipt.Logs == nil {
 				jsonReceipt.Logs = []*ethTypes.Log{}
 			}
+			if txFailed, err := m.state.GetFailedTx(txHash); err == nil {
+				jsonReceipt.Error = txFailed.GetError()
+			}
 		}
 		jsBlock.Transactions = append(jsBlock.Transactions, jsonReceipt)
 	}
@@ -334,22 +376,25 @@ returns: JSON JsonAccountList
 This endpoint returns the list of accounts CONTROLLED by the evm Service.
 These are accounts for which the Service has the private keys and on whose behalf
 it can sign transactions. The list of accounts controlled by the evm-service is
-contained in the Keystore directory defined upon launching the evm application.
+contained in the Keystore directory defined upon launching the evm application,
+or held by the external signer if one is configured.
 */
 func accountsHandler(w http.ResponseWriter, _ *http.Request, m *Service) {
 	m.logger.Debug("GET accounts")
 
 	var al JsonAccountList
 
-	for _, account := range m.keyStore.Accounts() {
-		balance := m.state.GetBalance(account.Address)
-		nonce := m.state.GetNonce(account.Address)
-		al.Accounts = append(al.Accounts,
-			JsonAccount{
-				Address: account.Address.Hex(),
-				Balance: balance,
-				Nonce:   nonce,
-			})
+	for _, wallet := range m.am.Wallets() {
+		for _, account := range wallet.Accounts() {
+			balance := m.state.GetBalance(account.Address)
+			nonce := m.state.GetNonce(account.Address)
+			al.Accounts = append(al.Accounts,
+				JsonAccount{
+					Address: account.Address.Hex(),
+					Balance: balance,
+					Nonce:   nonce,
+				})
+		}
 	}
 
 	js, err := json.Marshal(al)
@@ -369,20 +414,24 @@ func accountsHandler(w http.ResponseWriter, _ *http.Request, m *Service) {
 
 /*
 POST /call
-data: JSON SendTxArgs
+data: JSON JsonCallArgs
 returns: JSON JsonCallRes
 
 This endpoints allows calling SmartContract code for READONLY operations. These
 calls will NOT modify the EVM state.
 
 The data does NOT need to be signed.
+
+The optional stateOverride field replaces the balance, nonce, code, or storage
+(full "state" or partial "stateDiff") of accounts for the duration of the call
+only.
 */
 func callHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 	m.logger.WithField("request", r).Debug("POST call")
 
 	decoder := json.NewDecoder(r.Body)
-	var txArgs SendTxArgs
-	err := decoder.Decode(&txArgs)
+	var callArgs JsonCallArgs
+	err := decoder.Decode(&callArgs)
 	if err != nil {
 		m.logger.WithError(err).Error("Decoding JSON txArgs")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -396,14 +445,14 @@ func callHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 		}
 	})()
 
-	callMessage, err := prepareCallMessage(txArgs, m.keyStore)
+	callMessage, err := prepareCallMessage(callArgs.SendTxArgs)
 	if err != nil {
 		m.logger.WithError(err).Error("Converting to CallMessage")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	data, err := m.state.Call(*callMessage)
+	data, err := m.state.Call(*callMessage, callArgs.StateOverride, -1)
 	if err != nil {
 		m.logger.WithError(err).Error("Executing Call")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -426,6 +475,75 @@ func callHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 	}
 }
 
+/*
+POST /simulate
+data: JSON JsonSimulateArgs
+returns: JSON state.Simulation
+
+This endpoint executes a list of transactions in order, on top of the last block
+or of the block with the given index, as if they were included in the next
+block. Nothing is committed. It returns the receipt (status, gas used, logs) and
+return data of each transaction, and the resulting state diff.
+
+The transactions do NOT need to be signed, and their nonces are ignored.
+*/
+func simulateHandler(w http.ResponseWriter, r *http.Request, m *Service) {
+	m.logger.WithField("request", r).Debug("POST simulate")
+
+	decoder := json.NewDecoder(r.Body)
+	var simulateArgs JsonSimulateArgs
+	err := decoder.Decode(&simulateArgs)
+	if err != nil {
+		m.logger.WithError(err).Error("Decoding JSON simulateArgs")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer (func() {
+		if err := r.Body.Close(); err != nil {
+			m.logger.WithError(err).Error("Closing body")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})()
+
+	var msgs []ethTypes.Message
+	for _, txArgs := range simulateArgs.Transactions {
+		msg, err := prepareCallMessage(txArgs)
+		if err != nil {
+			m.logger.WithError(err).Error("Converting to CallMessage")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msgs = append(msgs, *msg)
+	}
+
+	blockIndex := int64(-1)
+	if simulateArgs.Block != nil {
+		blockIndex = *simulateArgs.Block
+	}
+
+	simulation, err := m.state.Simulate(msgs, blockIndex)
+	if err != nil {
+		m.logger.WithError(err).Error("Simulating transactions")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	js, err := json.Marshal(simulation)
+	if err != nil {
+		m.logger.WithError(err).Error("Marshaling JSON response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(js); err != nil {
+		m.logger.WithError(err).Error("Writing JSON response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 /*
 POST /tx
 data: JSON SendTxArgs
@@ -467,7 +585,7 @@ func transactionHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 		}
 	})()
 
-	tx, err := prepareTransaction(txArgs, m.state, m.keyStore)
+	tx, err := prepareTransaction(txArgs, m.state, m.am, m.chainConfig.ChainID)
 	if err != nil {
 		m.logger.WithError(err).Error("Preparing Transaction")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -602,8 +720,7 @@ func transactionReceiptHandler(w http.ResponseWriter, r *http.Request, m *Servic
 		}
 		tx = txFailed.GetTx()
 
-		signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-		from, err := ethTypes.Sender(signer, tx)
+		from, err := m.state.Sender(tx)
 		if err != nil {
 			m.logger.WithError(err).Error("Getting Tx Sender")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -623,8 +740,7 @@ func transactionReceiptHandler(w http.ResponseWriter, r *http.Request, m *Servic
 
 	} else {
 
-		signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-		from, err := ethTypes.Sender(signer, tx)
+		from, err := m.state.Sender(tx)
 		if err != nil {
 			m.logger.WithError(err).Error("Getting Tx Sender")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -651,13 +767,16 @@ func transactionReceiptHandler(w http.ResponseWriter, r *http.Request, m *Servic
 			ContractAddress:   receipt.ContractAddress,
 			Logs:              receipt.Logs,
 			LogsBloom:         receipt.Bloom,
-			Failed:            false,
+			Failed:            receipt.Status == ethTypes.ReceiptStatusFailed,
 			Status:            receipt.Status,
 		}
 
 		if receipt.Logs == nil {
 			jsonReceipt.Logs = []*ethTypes.Log{}
 		}
+		if txFailed, err := m.state.GetFailedTx(txHash); err == nil {
+			jsonReceipt.Error = txFailed.GetError()
+		}
 	}
 
 	js, err := json.Marshal(jsonReceipt)
@@ -704,8 +823,7 @@ func txReceiptHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 		}
 		tx = txFailed.GetTx()
 
-		signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-		from, err := ethTypes.Sender(signer, tx)
+		from, err := m.state.Sender(tx)
 		if err != nil {
 			m.logger.WithError(err).Error("Getting Tx Sender")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -725,8 +843,7 @@ func txReceiptHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 
 	} else {
 
-		signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-		from, err := ethTypes.Sender(signer, tx)
+		from, err := m.state.Sender(tx)
 		if err != nil {
 			m.logger.WithError(err).Error("Getting Tx Sender")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -753,13 +870,16 @@ func txReceiptHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 			ContractAddress:   receipt.ContractAddress,
 			Logs:              receipt.Logs,
 			LogsBloom:         receipt.Bloom,
-			Failed:            false,
+			Failed:            receipt.Status == ethTypes.ReceiptStatusFailed,
 			Status:            receipt.Status,
 		}
 
 		if receipt.Logs == nil {
 			jsonReceipt.Logs = []*ethTypes.Log{}
 		}
+		if txFailed, err := m.state.GetFailedTx(txHash); err == nil {
+			jsonReceipt.Error = txFailed.GetError()
+		}
 	}
 
 	js, err := json.Marshal(jsonReceipt)
@@ -792,6 +912,11 @@ func infoHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if stats == nil {
+		stats = make(map[string]string)
+	}
+	//nodes of the same network must report the same genesis
+	stats["genesis_hash"] = m.state.GenesisHash().Hex()
 
 	js, err := json.Marshal(stats)
 	if err != nil {
@@ -839,7 +964,7 @@ func htmlInfoHandler(w http.ResponseWriter, r *http.Request, m *Service) {
 }
 
 //------------------------------------------------------------------------------
-func prepareCallMessage(args SendTxArgs, _ *keystore.KeyStore) (*ethTypes.Message, error) {
+func prepareCallMessage(args SendTxArgs) (*ethTypes.Message, error) {
 	var err error
 	args, err = prepareSendTxArgs(args)
 	if err != nil {
@@ -870,7 +995,9 @@ func prepareCallMessage(args SendTxArgs, _ *keystore.KeyStore) (*ethTypes.Messag
 
 }
 
-func prepareTransaction(args SendTxArgs, state *state.State, ks *keystore.KeyStore) (*ethTypes.Transaction, error) {
+// prepareTransaction builds a transaction and signs it with the wallet of its
+// sender, from the keystore or the external signer
+func prepareTransaction(args SendTxArgs, state *state.State, am *accounts.Manager, chainID *big.Int) (*ethTypes.Transaction, error) {
 	var err error
 	args, err = prepareSendTxArgs(args)
 	if err != nil {
@@ -902,22 +1029,17 @@ func prepareTransaction(args SendTxArgs, state *state.State, ks *keystore.KeySto
 			[]byte(*args.Data))
 	}
 
-	signer := ethTypes.NewEIP155Signer(big.NewInt(1))
-
-	account, err := ks.Find(accounts.Account{Address: args.From})
-	if err != nil {
-		return nil, err
+	if state.IsImpersonated(args.From) {
+		return state.ImpersonatedTx(tx, args.From)
 	}
-	signature, err := ks.SignHash(account, signer.Hash(tx).Bytes())
-	if err != nil {
-		return nil, err
-	}
-	signedTx, err := tx.WithSignature(signer, signature)
+
+	account := accounts.Account{Address: args.From}
+	wallet, err := am.Find(account)
 	if err != nil {
 		return nil, err
 	}
 
-	return signedTx, nil
+	return wallet.SignTx(account, tx, chainID)
 }
 
 func prepareSendTxArgs(args SendTxArgs) (SendTxArgs, error) {
@@ -930,5 +1052,12 @@ func prepareSendTxArgs(args SendTxArgs) (SendTxArgs, error) {
 	if args.Value == nil {
 		args.Value = &hexutil.Big{}
 	}
+	if args.Data == nil {
+		if args.Input != nil {
+			args.Data = args.Input
+		} else {
+			args.Data = &hexutil.Bytes{}
+		}
+	}
 	return args, nil
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// readPasswords reads the passwords of the keystore accounts from a password
+// file. The file is either a JSON object mapping addresses to passwords, or a
+// list of passwords, one per line, in the order of the accounts; the last line
+// then applies to the remaining accounts, so that a single line unlocks all of
+// them. Accounts missing from a JSON file have no password.
+func readPasswords(file string, accs []accounts.Account) (map[common.Address]string, error) {
+	text, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords := make(map[common.Address]string)
+
+	if trimmed := bytes.TrimSpace(text); bytes.HasPrefix(trimmed, []byte("{")) {
+		var byAddress map[string]string
+		if err := json.Unmarshal(trimmed, &byAddress); err != nil {
+			return nil, err
+		}
+		for addr, pwd := range byAddress {
+			passwords[common.HexToAddress(addr)] = pwd
+		}
+		return passwords, nil
+	}
+
+	lines := strings.Split(string(text), "\n")
+	// Sanitise DOS line endings.
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	// Drop the empty lines at the end of the file, but keep an empty password
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i, ac := range accs {
+		if i < len(lines) {
+			passwords[ac.Address] = lines[i]
+		} else {
+			passwords[ac.Address] = lines[len(lines)-1]
+		}
+	}
+	return passwords, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+
+	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+)
+
+// newTestKeystore creates a keystore with an account for each of the given
+// passwords, with light key derivation parameters to keep tests fast
+func newTestKeystore(t *testing.T, dir string, passwords ...string) []accounts.Account {
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	for _, pwd := range passwords {
+		if _, err := ks.NewAccount(pwd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ks.Accounts()
+}
+
+func writePwdFile(t *testing.T, dir, content string) string {
+	file := filepath.Join(dir, "pwd.txt")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadPasswords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-passwords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	accs := []accounts.Account{
+		{Address: common.HexToAddress("0x01")},
+		{Address: common.HexToAddress("0x02")},
+		{Address: common.HexToAddress("0x03")},
+	}
+
+	cases := []struct {
+		content  string
+		expected []string
+	}{
+		// One password for all the accounts
+		{"secret\n\n", []string{"secret", "secret", "secret"}},
+		// One per account, the last one for the remaining accounts
+		{"one\r\ntwo\r\n", []string{"one", "two", "two"}},
+		// An empty password is kept
+		{"\n", []string{"", "", ""}},
+	}
+	for _, c := range cases {
+		passwords, err := readPasswords(writePwdFile(t, dir, c.content), accs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ac := range accs {
+			if pwd, ok := passwords[ac.Address]; !ok || pwd != c.expected[i] {
+				t.Fatalf("%q: password of account %d should be %q, not %q", c.content, i, c.expected[i], pwd)
+			}
+		}
+	}
+
+	// Accounts missing from a JSON file have no password
+	passwords, err := readPasswords(writePwdFile(t, dir,
+		`{"0x0000000000000000000000000000000000000002": "two"}`), accs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passwords) != 1 || passwords[accs[1].Address] != "two" {
+		t.Fatalf("only the second account should have a password, not %v", passwords)
+	}
+
+	if _, err := readPasswords(writePwdFile(t, dir, `{"0x01": 1}`), accs); err == nil {
+		t.Fatal("an invalid JSON file should be refused")
+	}
+}
+
+func TestUnlockAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-unlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keystoreDir := filepath.Join(dir, "keystore")
+	accs := newTestKeystore(t, keystoreDir, "one", "two", "three")
+
+	// The first account is left locked, and the third has no password
+	pwdFile := writePwdFile(t, dir, `{
+		"`+accs[0].Address.Hex()+`": "one",
+		"`+accs[1].Address.Hex()+`": "two"
+	}`)
+
+	s := &Service{
+		keystoreDir:    keystoreDir,
+		pwdFile:        pwdFile,
+		locked:         map[common.Address]bool{accs[0].Address: true},
+		unlockDuration: 500 * time.Millisecond,
+		logger:         bcommon.NewTestLogger(t),
+	}
+	if err := s.makeKeyStore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.unlockAccounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := make([]byte, 32)
+	for i, unlocked := range []bool{false, true, false} {
+		if _, err := s.keyStore.SignHash(accs[i], hash); (err == nil) != unlocked {
+			t.Fatalf("account %d should be unlocked: %v, not %v", i, unlocked, err == nil)
+		}
+	}
+
+	// Unlocks are timed
+	time.Sleep(time.Second)
+	if _, err := s.keyStore.SignHash(accs[1], hash); err == nil {
+		t.Fatal("account should be locked again after the unlock duration")
+	}
+
+	// A wrong password is an error
+	s.pwdFile = writePwdFile(t, dir, "wrong\n")
+	s.locked = nil
+	if err := s.unlockAccounts(); err == nil {
+		t.Fatal("a wrong password should be an error")
+	}
+}
+
+func TestUnlockAccountDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-unlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keystoreDir := filepath.Join(dir, "keystore")
+	accs := newTestKeystore(t, keystoreDir, "one")
+
+	// The account is unlocked until the node stops
+	s := &Service{
+		keystoreDir: keystoreDir,
+		pwdFile:     writePwdFile(t, dir, "one\n"),
+		logger:      bcommon.NewTestLogger(t),
+	}
+	if err := s.makeKeyStore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.unlockAccounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	api := NewPrivateAccountAPI(s, nil)
+	duration := uint64(1)
+	if ok, err := api.UnlockAccount(accs[0].Address, "two", &duration); ok || err == nil {
+		t.Fatal("a wrong password should not unlock the account")
+	}
+	hash := make([]byte, 32)
+	if _, err := s.keyStore.SignHash(accs[0], hash); err != nil {
+		t.Fatal("a failed unlock should leave the account unlocked")
+	}
+
+	// The requested duration replaces the startup unlock
+	if ok, err := api.UnlockAccount(accs[0].Address, "one", &duration); !ok || err != nil {
+		t.Fatalf("account should be unlocked: %v", err)
+	}
+	if _, err := s.keyStore.SignHash(accs[0], hash); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := s.keyStore.SignHash(accs[0], hash); err == nil {
+		t.Fatal("account should be locked after the requested duration")
+	}
+}
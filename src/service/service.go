@@ -1,23 +1,20 @@
 package service
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"math/big"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 
-	"github.com/Fantom-foundation/go-evm/src/common"
 	"github.com/Fantom-foundation/go-evm/src/config"
 	"github.com/Fantom-foundation/go-evm/src/state"
 )
@@ -31,65 +28,80 @@ type Service struct {
 	chainConfig *params.ChainConfig
 	state       *state.State
 	submitCh    chan []byte
-	genesisFile string
 	keystoreDir string
 	apiAddr     string
 	keyStore    *keystore.KeyStore
 	am          *accounts.Manager
 	pwdFile     string
+	signer      string
 	logger      *logrus.Logger
 
+	// accounts left locked at startup, and duration of the unlock of the others
+	locked         map[common.Address]bool
+	unlockDuration time.Duration
+
 	rpcConfig *node.Config
 	rpcServer *RpcServer
 
 	//XXX
 	getInfo infoCallback
+
+	readConsistency ReadConsistency
+	readBarrier     readBarrierCallback
 }
 
-func NewService(genesisFile, keystoreDir, apiAddr, pwdFile string,
+func NewService(keystoreDir, apiAddr, pwdFile, readConsistency, signer string,
+	locked []string,
+	unlockDuration time.Duration,
 	state *state.State,
 	submitCh chan []byte,
-	logger *logrus.Logger) *Service {
+	logger *logrus.Logger) (*Service, error) {
 	// TODO: replace DefaultRpcConfig with custom
 	rpcConfig := &config.DefaultRpcConfig
-	// TODO: replace ChainConfig with custom
-	chainConfig := &params.ChainConfig{
-		ChainID: big.NewInt(666),
+	defaultConsistency, err := ParseReadConsistency(readConsistency)
+	if err != nil {
+		return nil, err
+	}
+
+	lockedAccounts := make(map[common.Address]bool)
+	for _, addr := range locked {
+		lockedAccounts[common.HexToAddress(addr)] = true
 	}
 
 	s := &Service{
-		chainConfig: chainConfig,
-		genesisFile: genesisFile,
-		keystoreDir: keystoreDir,
-		apiAddr:     apiAddr,
-		pwdFile:     pwdFile,
-		state:       state,
-		submitCh:    submitCh,
-		logger:      logger,
+		chainConfig:    state.ChainConfig(),
+		keystoreDir:    keystoreDir,
+		apiAddr:        apiAddr,
+		pwdFile:        pwdFile,
+		signer:         signer,
+		locked:         lockedAccounts,
+		unlockDuration: unlockDuration,
+		state:          state,
+		submitCh:       submitCh,
+		logger:         logger,
 		// TODO: no-default rpcConfig required
-		rpcConfig: rpcConfig,
+		rpcConfig:       rpcConfig,
+		readConsistency: defaultConsistency,
 	}
-	var err error
 	s.rpcServer, err = NewRpcServer(rpcConfig, s)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	err = s.rpcServer.Register(NewWeb3AccountServiceConstructor(s))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	err = s.rpcServer.Register(NewWeb3ChainServiceConstructor(s))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return s
+	return s, nil
 }
 
 func (m *Service) Run() {
 	m.checkErr(m.makeKeyStore())
 	m.checkErr(m.unlockAccounts())
-	m.checkErr(m.createGenesisAccounts())
 
 	m.logger.Info("serving web3-api ...")
 	if err := m.rpcServer.Start(); err != nil {
@@ -115,8 +127,24 @@ func (m *Service) SetInfoCallback(f infoCallback) {
 	m.getInfo = f
 }
 
+// makeKeyStore sets up the account manager with the backend which signs
+// transactions: the keystore, or the external signer if one is configured, in
+// which case no key is loaded in the node
 func (m *Service) makeKeyStore() error {
 
+	if m.signer != "" {
+		signer, err := NewExternalSigner(m.signer)
+		if err != nil {
+			return err
+		}
+		m.am = accounts.NewManager(signer)
+		m.logger.WithFields(logrus.Fields{
+			"signer":   m.signer,
+			"accounts": len(signer.Accounts()),
+		}).Info("Using external signer")
+		return nil
+	}
+
 	scryptN := keystore.StandardScryptN
 	scryptP := keystore.StandardScryptP
 
@@ -133,63 +161,59 @@ func (m *Service) makeKeyStore() error {
 
 func (m *Service) unlockAccounts() error {
 
-	if len(m.keyStore.Accounts()) == 0 {
+	// the external signer unlocks its own accounts
+	if m.keyStore == nil || len(m.keyStore.Accounts()) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(m.pwdFile); os.IsNotExist(err) {
+		m.logger.WithField("pwd", m.pwdFile).Warn("No password file, accounts stay locked")
 		return nil
 	}
 
-	pwd, err := m.readPwd()
+	passwords, err := readPasswords(m.pwdFile, m.keyStore.Accounts())
 	if err != nil {
 		m.logger.WithError(err).Error("Reading PwdFile")
 		return err
 	}
 
 	for _, ac := range m.keyStore.Accounts() {
-		if err := m.keyStore.Unlock(ac, string(pwd)); err != nil {
+		if m.locked[ac.Address] {
+			m.logger.WithField("address", ac.Address.Hex()).Debug("Leaving account locked")
+			continue
+		}
+		pwd, ok := passwords[ac.Address]
+		if !ok {
+			m.logger.WithField("address", ac.Address.Hex()).Debug("No password, leaving account locked")
+			continue
+		}
+		if err := m.keyStore.TimedUnlock(ac, pwd, m.unlockDuration); err != nil {
 			return err
 		}
-		m.logger.WithField("address", ac.Address.Hex()).Debug("Unlocked account")
-	}
-	return nil
-}
-
-func (m *Service) createGenesisAccounts() error {
-	if _, err := os.Stat(m.genesisFile); os.IsNotExist(err) {
-		return nil
-	}
-
-	contents, err := ioutil.ReadFile(m.genesisFile)
-	if err != nil {
-		return err
-	}
-
-	var genesis struct {
-		Alloc common.AccountMap
-	}
-
-	if err := json.Unmarshal(contents, &genesis); err != nil {
-		return err
-	}
-
-	if err := m.state.CreateAccounts(genesis.Alloc); err != nil {
-		return err
+		m.logger.WithFields(logrus.Fields{
+			"address":  ac.Address.Hex(),
+			"duration": m.unlockDuration,
+		}).Debug("Unlocked account")
 	}
 	return nil
 }
 
 func (m *Service) serveAPI() {
 	r := mux.NewRouter()
-	r.HandleFunc("/account/{address}", m.makeHandler(accountHandler)).Methods("GET")
-	r.HandleFunc("/accounts", m.makeHandler(accountsHandler)).Methods("GET")
-	r.HandleFunc("/block/{hash}", m.makeHandler(blockByHashHandler)).Methods("GET")
-	r.HandleFunc("/blockById/{id}", m.makeHandler(blockByIdHandler)).Methods("GET")
+	r.HandleFunc("/account/{address}", m.makeReadHandler(accountHandler)).Methods("GET")
+	r.HandleFunc("/accounts", m.makeReadHandler(accountsHandler)).Methods("GET")
+	r.HandleFunc("/block/{hash}", m.makeReadHandler(blockByHashHandler)).Methods("GET")
+	r.HandleFunc("/blockById/{id}", m.makeReadHandler(blockByIdHandler)).Methods("GET")
+	r.HandleFunc("/stateDiff/{id}", m.makeReadHandler(stateDiffHandler)).Methods("GET")
 	//r.HandleFunc("/blockIndex", m.makeHandler(blockIndexHandler)).Methods("GET")
-	r.HandleFunc("/call", m.makeHandler(callHandler)).Methods("POST")
+	r.HandleFunc("/call", m.makeReadHandler(callHandler)).Methods("POST")
+	r.HandleFunc("/simulate", m.makeReadHandler(simulateHandler)).Methods("POST")
 	r.HandleFunc("/tx", m.makeHandler(transactionHandler)).Methods("POST")
 	r.HandleFunc("/transactions", m.makeHandler(transactionHandler)).Methods("POST")
 	r.HandleFunc("/rawtx", m.makeHandler(rawTransactionHandler)).Methods("POST")
 	r.HandleFunc("/sendRawTransaction", m.makeHandler(rawTransactionHandler)).Methods("POST")
-	r.HandleFunc("/tx/{tx_hash}", m.makeHandler(txReceiptHandler)).Methods("GET")
-	r.HandleFunc("/transaction/{tx_hash}", m.makeHandler(transactionReceiptHandler)).Methods("GET")
+	r.HandleFunc("/tx/{tx_hash}", m.makeReadHandler(txReceiptHandler)).Methods("GET")
+	r.HandleFunc("/transaction/{tx_hash}", m.makeReadHandler(transactionReceiptHandler)).Methods("GET")
 	r.HandleFunc("/info", m.makeHandler(infoHandler)).Methods("GET")
 	r.HandleFunc("/html/info", m.makeHandler(htmlInfoHandler)).Methods("GET")
 	http.Handle("/", &CORSServer{r})
@@ -207,7 +231,7 @@ func (s *CORSServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		rw.Header().Set("Access-Control-Allow-Origin", origin)
 		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 		rw.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+ReadConsistencyHeader)
 	}
 	// Stop here if its Preflighted OPTIONS request
 	if req.Method == "OPTIONS" {
@@ -232,19 +256,6 @@ func (m *Service) checkErr(err error) {
 	}
 }
 
-func (m *Service) readPwd() (pwd string, err error) {
-	text, err := ioutil.ReadFile(m.pwdFile)
-	if err != nil {
-		return "", err
-	}
-	lines := strings.Split(string(text), "\n")
-	// Sanitise DOS line endings.
-	for i := range lines {
-		lines[i] = strings.TrimRight(lines[i], "\r")
-	}
-	return lines[0], nil
-}
-
 func (s *Service) AccountManager() *accounts.Manager {
 	return s.am
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
 )
 
 type JsonAccount struct {
@@ -30,6 +32,16 @@ type SendTxArgs struct {
 }
 */
 
+type JsonCallArgs struct {
+	SendTxArgs
+	StateOverride state.StateOverride `json:"stateOverride"`
+}
+
+type JsonSimulateArgs struct {
+	Transactions []SendTxArgs `json:"transactions"`
+	Block        *int64       `json:"block"`
+}
+
 type JsonCallRes struct {
 	Data string `json:"data"`
 }
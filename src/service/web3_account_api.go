@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 
 	//"strings"
@@ -32,10 +33,14 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	//"github.com/syndtr/goleveldb/leveldb"
 	//"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
 )
 
 var (
 	defaultGasPrice = new(big.Int).Mul(big.NewInt(1), big.NewInt(params.GWei))
+	// defaultCallGas is the gas allowance of calls which don't specify one
+	defaultCallGas = uint64(50000000)
 )
 
 // PublicEthereumAPI provides an API to access Ethereum related information.
@@ -291,16 +296,28 @@ func (s *PrivateAccountAPI) DeriveAccount(url string, path string, pin *bool) (a
 
 // NewAccount will create a new account and returns the address for the new account.
 func (s *PrivateAccountAPI) NewAccount(password string) (common.Address, error) {
-	acc, err := fetchKeystore(s.am).NewAccount(password)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return common.Address{}, err
+	}
+	acc, err := ks.NewAccount(password)
 	if err == nil {
 		return acc.Address, nil
 	}
 	return common.Address{}, err
 }
 
+// errNoKeystore is returned by the keystore methods when transactions are
+// signed by an external signer
+var errNoKeystore = errors.New("accounts are managed by the external signer")
+
 // fetchKeystore retrives the encrypted keystore from the account manager.
-func fetchKeystore(am *accounts.Manager) *keystore.KeyStore {
-	return am.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+func fetchKeystore(am *accounts.Manager) (*keystore.KeyStore, error) {
+	backends := am.Backends(keystore.KeyStoreType)
+	if len(backends) == 0 {
+		return nil, errNoKeystore
+	}
+	return backends[0].(*keystore.KeyStore), nil
 }
 
 // ImportRawKey stores the given hex encoded ECDSA key into the key directory,
@@ -310,13 +327,19 @@ func (s *PrivateAccountAPI) ImportRawKey(privkey string, password string) (commo
 	if err != nil {
 		return common.Address{}, err
 	}
-	acc, err := fetchKeystore(s.am).ImportECDSA(key, password)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return common.Address{}, err
+	}
+	acc, err := ks.ImportECDSA(key, password)
 	return acc.Address, err
 }
 
 // UnlockAccount will unlock the account associated with the given address with
 // the given password for duration seconds. If duration is nil it will use a
-// default of 300 seconds. It returns an indication if the account was unlocked.
+// default of 300 seconds, and 0 unlocks it until the node stops. The duration
+// replaces that of any previous unlock. It returns an indication if the account
+// was unlocked.
 func (s *PrivateAccountAPI) UnlockAccount(addr common.Address, password string, duration *uint64) (bool, error) {
 	const max = uint64(time.Duration(math.MaxInt64) / time.Second)
 	var d time.Duration
@@ -327,13 +350,38 @@ func (s *PrivateAccountAPI) UnlockAccount(addr common.Address, password string,
 	} else {
 		d = time.Duration(*duration) * time.Second
 	}
-	err := fetchKeystore(s.am).TimedUnlock(accounts.Account{Address: addr}, password, d)
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return false, err
+	}
+	account, err := ks.Find(accounts.Account{Address: addr})
+	if err != nil {
+		return false, err
+	}
+	// The keystore ignores the duration of an unlock when the account is
+	// already unlocked indefinitely, e.g. at startup. Check the password first,
+	// then lock the account so that the requested duration applies.
+	keyJSON, err := ioutil.ReadFile(account.URL.Path)
+	if err != nil {
+		return false, err
+	}
+	if _, err := keystore.DecryptKey(keyJSON, password); err != nil {
+		return false, err
+	}
+	if err := ks.Lock(addr); err != nil {
+		return false, err
+	}
+	err = ks.TimedUnlock(account, password, d)
 	return err == nil, err
 }
 
 // LockAccount will lock the account associated with the given address when it's unlocked.
 func (s *PrivateAccountAPI) LockAccount(addr common.Address) bool {
-	return fetchKeystore(s.am).Lock(addr) == nil
+	ks, err := fetchKeystore(s.am)
+	if err != nil {
+		return false
+	}
+	return ks.Lock(addr) == nil
 }
 
 // signTransactions sets defaults and signs the given transaction
@@ -485,15 +533,31 @@ func NewPublicBlockChainAPI(b *Service) *PublicBlockChainAPI {
 }
 
 // BlockNumber returns the block number of the chain head.
-func (s *PublicBlockChainAPI) BlockNumber() hexutil.Uint64 {
-	return hexutil.Uint64(s.backend.state.GetBlockIndex())
+// The optional consistency parameter overrides the default read consistency
+// level (stale, lease or linearizable).
+func (s *PublicBlockChainAPI) BlockNumber(consistency *string) (hexutil.Uint64, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(s.backend.state.GetBlockIndex()), nil
 }
 
 // GetBalance returns the amount of wei for the given address in the state of the
 // given block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
-// block numbers are also allowed.
-func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Big, error) {
-	balance := s.backend.state.GetBalance(address)
+// block numbers are also allowed. The optional consistency parameter overrides
+// the default read consistency level.
+func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber, consistency *string) (*hexutil.Big, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+	balance, err := s.backend.state.GetBalanceAt(address, blockIndex)
+	if err != nil {
+		return nil, err
+	}
 	return (*hexutil.Big)(balance), nil
 }
 
@@ -593,31 +657,53 @@ func (s *PublicBlockChainAPI) GetUncleCountByBlockHash(ctx context.Context, bloc
 }
 
 // GetCode returns the code stored at the given address in the state for the given block number.
-func (s *PublicBlockChainAPI) GetCode(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	/*
-		state, _, err := s.backend.StateAndHeaderByNumber(ctx, blockNr)
-		if state == nil || err != nil {
-			return nil, err
-		}
-		code := state.GetCode(address)
-		return code, state.Error()
-	*/
-	return nil, ErrNotImplemented
+// The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block numbers are
+// also allowed. The optional consistency parameter overrides the default read
+// consistency level.
+func (s *PublicBlockChainAPI) GetCode(ctx context.Context, address common.Address, blockNr rpc.BlockNumber, consistency *string) (hexutil.Bytes, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+	return s.backend.state.GetCodeAt(address, blockIndex)
+}
+
+// GetProof returns the EIP-1186 Merkle proof of an account and of some of its
+// storage slots, against the state root of the given block number.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*state.AccountResult, error) {
+	keys := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		keys[i] = common.HexToHash(key)
+	}
+
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+
+	return s.backend.state.GetProof(address, keys, blockIndex)
 }
 
 // GetStorageAt returns the storage from the state at the given address, key and
 // block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block
-// numbers are also allowed.
-func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.Address, key string, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	/*
-		state, _, err := s.backend.StateAndHeaderByNumber(ctx, blockNr)
-		if state == nil || err != nil {
-			return nil, err
-		}
-		res := state.GetState(address, common.HexToHash(key))
-		return res[:], state.Error()
-	*/
-	return nil, ErrNotImplemented
+// numbers are also allowed. The optional consistency parameter overrides the
+// default read consistency level.
+func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.Address, key string, blockNr rpc.BlockNumber, consistency *string) (hexutil.Bytes, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+	res, err := s.backend.state.GetStorageAtBlock(address, common.HexToHash(key), blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return res[:], nil
 }
 
 // CallArgs represents the arguments for a call.
@@ -630,78 +716,81 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, bool, error) {
-	/*
-		defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *state.StateOverride) ([]byte, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
-		state, header, err := s.backend.StateAndHeaderByNumber(ctx, blockNr)
-		if state == nil || err != nil {
-			return nil, 0, false, err
-		}
-		// Set sender address or use a default if none specified
-		addr := args.From
-		if addr == (common.Address{}) {
-			if wallets := s.backend.AccountManager().Wallets(); len(wallets) > 0 {
-				if accounts := wallets[0].Accounts(); len(accounts) > 0 {
-					addr = accounts[0].Address
-				}
+	// Set sender address or use a default if none specified
+	addr := args.From
+	if addr == (common.Address{}) {
+		if wallets := s.backend.AccountManager().Wallets(); len(wallets) > 0 {
+			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
+				addr = accounts[0].Address
 			}
 		}
-		// Set default gas & gas price if none were set
-		gas, gasPrice := uint64(args.Gas), args.GasPrice.ToInt()
-		if gas == 0 {
-			gas = math.MaxUint64 / 2
-		}
-		if gasPrice.Sign() == 0 {
-			gasPrice = new(big.Int).SetUint64(defaultGasPrice)
-		}
+	}
+	// Set default gas & gas price if none were set
+	gas, gasPrice := uint64(args.Gas), args.GasPrice.ToInt()
+	if gas == 0 {
+		gas = defaultCallGas
+	}
+	if gasPrice.Sign() == 0 {
+		gasPrice = defaultGasPrice
+	}
 
-		// Create new call message
-		msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+	// Create new call message
+	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
 
-		// Setup context so it may be cancelled the call has completed
-		// or, in case of unmetered gas, setup a context with a timeout.
-		var cancel context.CancelFunc
-		if timeout > 0 {
-			ctx, cancel = context.WithTimeout(ctx, timeout)
-		} else {
-			ctx, cancel = context.WithCancel(ctx)
-		}
-		// Make sure the context is cancelled when the call has completed
-		// this makes sure resources are cleaned up.
-		defer cancel()
+	var accounts state.StateOverride
+	if overrides != nil {
+		accounts = *overrides
+	}
 
-		// Get a new instance of the EVM.
-		evm, vmError, err := s.backend.GetEVM(ctx, msg, state, header, vmCfg)
-		if err != nil {
-			return nil, 0, false, err
-		}
-		// Wait for the context to be done and cancel the evm. Even if the
-		// EVM has finished, cancelling may be done (repeatedly)
-		go func() {
-			<-ctx.Done()
-			evm.Cancel()
-		}()
-
-		// Setup the gas pool (also for unmetered requests)
-		// and apply the message.
-		gp := new(core.GasPool).AddGas(math.MaxUint64)
-		res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
-		if err := vmError(); err != nil {
-			return nil, 0, false, err
-		}
-		return res, gas, failed, err
-	*/
-	return nil, 0, false, ErrNotImplemented
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+
+	return s.backend.state.Call(msg, accounts, blockIndex)
 }
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
+// The optional overrides replace the balance, nonce, code or storage of accounts
+// for the duration of the call only.
+// The optional consistency parameter overrides the default read consistency level.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *state.StateOverride, consistency *string) (hexutil.Bytes, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
+	result, err := s.doCall(ctx, args, blockNr, overrides)
 	return (hexutil.Bytes)(result), err
 }
 
+// Simulate executes the given transactions in order, on top of the state for the
+// given block number, as if they were included in the next block. Nothing is
+// committed. It returns the receipt and return data of each transaction, and the
+// resulting state diff.
+func (s *PublicBlockChainAPI) Simulate(ctx context.Context, args []CallArgs, blockNr rpc.BlockNumber) (*state.Simulation, error) {
+	msgs := make([]types.Message, len(args))
+	for i, arg := range args {
+		gas, gasPrice := uint64(arg.Gas), arg.GasPrice.ToInt()
+		if gas == 0 {
+			gas = defaultCallGas
+		}
+		if gasPrice.Sign() == 0 {
+			gasPrice = defaultGasPrice
+		}
+		msgs[i] = types.NewMessage(arg.From, arg.To, 0, arg.Value.ToInt(), gas, gasPrice, arg.Data, false)
+	}
+
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+
+	return s.backend.state.Simulate(msgs, blockIndex)
+}
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
@@ -1046,17 +1135,23 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockHashAndIndex(ctx cont
 	return nil
 }
 
-// GetTransactionCount returns the number of transactions the given address has sent for the given block number
-func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Uint64, error) {
-	/*
-		state, _, err := s.backend.StateAndHeaderByNumber(ctx, blockNr)
-		if state == nil || err != nil {
-			return nil, err
-		}
-		nonce := state.GetNonce(address)
-		return (*hexutil.Uint64)(&nonce), state.Error()
-	*/
-	return nil, ErrNotImplemented
+// GetTransactionCount returns the number of transactions the given address has sent for the given block number.
+// The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block numbers are
+// also allowed. The optional consistency parameter overrides the default read
+// consistency level.
+func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr rpc.BlockNumber, consistency *string) (*hexutil.Uint64, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
+	blockIndex := int64(-1)
+	if blockNr >= 0 {
+		blockIndex = blockNr.Int64()
+	}
+	nonce, err := s.backend.state.GetNonceAt(address, blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Uint64)(&nonce), nil
 }
 
 // GetTransactionByHash returns the transaction for the given hash
@@ -1095,57 +1190,51 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 }
 
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
-func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
-	/*
-		tx, blockHash, blockNumber, index := rawdb.ReadTransaction(s.backend.ChainDb(), hash)
-		if tx == nil {
-			return nil, nil
-		}
-		receipts, err := s.backend.GetReceipts(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		if len(receipts) <= int(index) {
-			return nil, nil
-		}
-		receipt := receipts[index]
+// The optional consistency parameter overrides the default read consistency
+// level.
+func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash, consistency *string) (map[string]interface{}, error) {
+	if err := s.backend.waitForRPCRead(consistency); err != nil {
+		return nil, err
+	}
 
-		var signer types.Signer = types.FrontierSigner{}
-		if tx.Protected() {
-			signer = types.NewEIP155Signer(tx.ChainId())
-		}
-		from, _ := types.Sender(signer, tx)
-
-		fields := map[string]interface{}{
-			"blockHash":         blockHash,
-			"blockNumber":       hexutil.Uint64(blockNumber),
-			"transactionHash":   hash,
-			"transactionIndex":  hexutil.Uint64(index),
-			"from":              from,
-			"to":                tx.To(),
-			"gasUsed":           hexutil.Uint64(receipt.GasUsed),
-			"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
-			"contractAddress":   nil,
-			"logs":              receipt.Logs,
-			"logsBloom":         receipt.Bloom,
-		}
+	tx, err := s.backend.state.GetTransaction(hash)
+	if err != nil {
+		return nil, nil
+	}
+	receipt, err := s.backend.state.GetReceipt(hash)
+	if err != nil {
+		return nil, nil
+	}
+	from, err := s.backend.state.Sender(tx)
+	if err != nil {
+		return nil, err
+	}
 
-		// Assign receipt status or post state.
-		if len(receipt.PostState) > 0 {
-			fields["root"] = hexutil.Bytes(receipt.PostState)
-		} else {
-			fields["status"] = hexutil.Uint(receipt.Status)
-		}
-		if receipt.Logs == nil {
-			fields["logs"] = [][]*types.Log{}
-		}
-		// If the ContractAddress is 20 0x0 bytes, assume it is not a contract creation
-		if receipt.ContractAddress != (common.Address{}) {
-			fields["contractAddress"] = receipt.ContractAddress
-		}
-		return fields, nil
-	*/
-	return nil, ErrNotImplemented
+	fields := map[string]interface{}{
+		"transactionHash":   hash,
+		"from":              from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+	}
+
+	// Assign receipt status or post state.
+	if len(receipt.PostState) > 0 {
+		fields["root"] = hexutil.Bytes(receipt.PostState)
+	} else {
+		fields["status"] = hexutil.Uint(receipt.Status)
+	}
+	if receipt.Logs == nil {
+		fields["logs"] = [][]*types.Log{}
+	}
+	// If the ContractAddress is 20 0x0 bytes, assume it is not a contract creation
+	if receipt.ContractAddress != (common.Address{}) {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields, nil
 }
 
 // sign is a helper function that signs a transaction with the private key of the given address.
@@ -1184,13 +1273,14 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b *Service) error {
 		*(*uint64)(args.Gas) = 90000
 	}
 	if args.GasPrice == nil {
-		*args.GasPrice = hexutil.Big(*defaultGasPrice)
+		args.GasPrice = (*hexutil.Big)(new(big.Int).Set(defaultGasPrice))
 	}
 	if args.Value == nil {
 		args.Value = new(hexutil.Big)
 	}
 	if args.Nonce == nil {
-		*args.Nonce = hexutil.Uint64(b.state.GetPoolNonce(args.From))
+		args.Nonce = new(hexutil.Uint64)
+		*(*uint64)(args.Nonce) = b.state.GetPoolNonce(args.From)
 	}
 	if args.Data != nil && args.Input != nil && !bytes.Equal(*args.Data, *args.Input) {
 		return errors.New(
@@ -1227,8 +1317,7 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 // submitTransaction is a helper function that submits tx to txPool and logs a message.
 func submitTransaction(ctx context.Context, b *Service, tx *types.Transaction) (common.Hash, error) {
 	if tx.To() == nil {
-		signer := types.MakeSigner(b.ChainConfig(), big.NewInt(b.state.GetBlockIndex()))
-		from, err := types.Sender(signer, tx)
+		from, err := b.state.Sender(tx)
 		if err != nil {
 			return common.Hash{}, err
 		}
@@ -1238,7 +1327,7 @@ func submitTransaction(ctx context.Context, b *Service, tx *types.Transaction) (
 		log.Info("Submitted transaction", "fullhash", tx.Hash().Hex(), "recipient", tx.To())
 	}
 
-	raw, err := tx.MarshalJSON()
+	raw, err := rlp.EncodeToBytes(tx)
 	if err != nil {
 		return common.Hash{}, err
 	}
@@ -1250,6 +1339,11 @@ func submitTransaction(ctx context.Context, b *Service, tx *types.Transaction) (
 // SendTransaction creates a transaction for the given argument, sign it and submit it to the
 // transaction pool.
 func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	// Impersonated accounts don't need a wallet
+	if s.backend.state.IsImpersonated(args.From) {
+		return s.sendImpersonatedTransaction(ctx, args)
+	}
+
 	// Look up the wallet containing the requested signer
 	account := accounts.Account{Address: args.From}
 
@@ -1282,6 +1376,25 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 
 }
 
+// sendImpersonatedTransaction submits a transaction on behalf of an account
+// impersonated in dev mode, without signing it.
+func (s *PublicTransactionPoolAPI) sendImpersonatedTransaction(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	if args.Nonce == nil {
+		s.nonceLock.LockAddr(args.From)
+		defer s.nonceLock.UnlockAddr(args.From)
+	}
+
+	if err := args.setDefaults(ctx, s.backend); err != nil {
+		return common.Hash{}, err
+	}
+
+	tx, err := s.backend.state.ImpersonatedTx(args.toTransaction(), args.From)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return submitTransaction(ctx, s.backend, tx)
+}
+
 // SendRawTransaction will add the signed transaction to the transaction pool.
 // The sender is responsible for signing the transaction and using the correct nonce.
 func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
@@ -1480,6 +1593,13 @@ func (api *PublicDebugAPI) SeedHash(ctx context.Context, number uint64) (string,
 	return "", ErrNotImplemented
 }
 
+// GetStateDiff returns the accounts and storage slots changed by a block, with
+// their values before and after it. State diffs are only recorded when enabled
+// with --eth.state-diffs.
+func (api *PublicDebugAPI) GetStateDiff(ctx context.Context, number uint64) (state.StateDiff, error) {
+	return api.backend.state.GetStateDiff(int64(number))
+}
+
 // PrivateDebugAPI is the collection of Ethereum APIs exposed over the private
 // debugging endpoint.
 type PrivateDebugAPI struct {
@@ -1532,11 +1652,10 @@ func (api *PrivateDebugAPI) ChaindbCompact() error {
 	return ErrNotImplemented
 }
 
-// SetHead rewinds the head of the blockchain to a previous block.
-func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) {
-	/*
-		api.backend.SetHead(uint64(number))
-	*/
+// SetHead rewinds the head of the blockchain to a previous block. Blocks above
+// it are deleted, along with their transactions and receipts.
+func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) error {
+	return api.backend.state.Rewind(int64(number))
 }
 
 // PublicNetAPI offers network related RPC methods
@@ -1,28 +1,28 @@
 package service
 
 import (
-	//"compress/gzip"
+	"compress/gzip"
 	"context"
 	//"errors"
 	"fmt"
-	//"io"
+	"io"
 	//"math/big"
-	//"os"
+	"os"
 	//"runtime"
-	//"strings"
+	"strings"
 	//"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
 	//"github.com/ethereum/go-ethereum/core/rawdb"
 	//"github.com/Fantom-foundation/go-evm/src/service/internal/ethapi"
+
+	bstate "github.com/Fantom-foundation/go-evm/src/state"
 )
 
 var ErrNotImplemented = fmt.Errorf("not implemented yet")
@@ -86,94 +86,50 @@ func NewPrivateAdminAPI(eth *Service) *PrivateAdminAPI {
 	return &PrivateAdminAPI{eth: eth}
 }
 
-// ExportChain exports the current blockchain into a local file.
+// ExportChain exports the current blockchain into a local file. The file is
+// gzipped if its name ends with ".gz".
 func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
-	/*
-		// Make sure we can create the file to export into
-		out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
-		if err != nil {
-			return false, err
-		}
-		defer out.Close()
-
-		var writer io.Writer = out
-		if strings.HasSuffix(file, ".gz") {
-			writer = gzip.NewWriter(writer)
-			defer writer.(*gzip.Writer).Close()
-		}
-
-		// Export the blockchain
-		if err := api.eth.BlockChain().Export(writer); err != nil {
-			return false, err
-		}
-		return true, nil
-	*/
-	return false, ErrNotImplemented
-}
+	// Make sure we can create the file to export into
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
 
-func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
-	/*
-		for _, b := range bs {
-			if !chain.HasBlock(b.Hash(), b.NumberU64()) {
-				return false
-			}
-		}
+	var writer io.Writer = out
+	if strings.HasSuffix(file, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
 
-		return true
-	*/
-	return false
+	// Export the blockchain
+	if _, err := api.eth.state.ExportChain(writer, 0, -1); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// ImportChain imports a blockchain from a local file.
+// ImportChain imports a blockchain from a local file, re-executing every block
+// and checking the resulting state roots.
 func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
-	/*
-		// Make sure the can access the file to import
-		in, err := os.Open(file)
-		if err != nil {
-			return false, err
-		}
-		defer in.Close()
+	// Make sure the can access the file to import
+	in, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
 
-		var reader io.Reader = in
-		if strings.HasSuffix(file, ".gz") {
-			if reader, err = gzip.NewReader(reader); err != nil {
-				return false, err
-			}
+	var reader io.Reader = in
+	if strings.HasSuffix(file, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return false, err
 		}
+	}
 
-		// Run actual the import in pre-configured batches
-		stream := rlp.NewStream(reader, 0)
-
-		blocks, index := make([]*types.Block, 0, 2500), 0
-		for batch := 0; ; batch++ {
-			// Load a batch of blocks from the input file
-			for len(blocks) < cap(blocks) {
-				block := new(types.Block)
-				if err := stream.Decode(block); err == io.EOF {
-					break
-				} else if err != nil {
-					return false, fmt.Errorf("block %d: failed to parse: %v", index, err)
-				}
-				blocks = append(blocks, block)
-				index++
-			}
-			if len(blocks) == 0 {
-				break
-			}
-
-			if hasAllBlocks(api.eth.BlockChain(), blocks) {
-				blocks = blocks[:0]
-				continue
-			}
-			// Import the batch and reset the buffer
-			if _, err := api.eth.BlockChain().InsertChain(blocks); err != nil {
-				return false, fmt.Errorf("batch %d: failed to insert: %v", batch, err)
-			}
-			blocks = blocks[:0]
-		}
-		return true, nil
-	*/
-	return false, ErrNotImplemented
+	if _, err := api.eth.state.ImportChain(reader); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // PublicDebugChainAPI is the collection of Ethereum full node APIs exposed
@@ -189,31 +145,27 @@ func NewPublicDebugChainAPI(eth *Service) *PublicDebugChainAPI {
 }
 
 // DumpBlock retrieves the entire state of the database at a given block.
-func (api *PublicDebugChainAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
-	/*
-		if blockNr == rpc.PendingBlockNumber {
-			// If we're dumping the pending state, we need to request
-			// both the pending block as well as the pending state from
-			// the miner and operate on those
-			_, stateDb := api.eth.miner.Pending()
-			return stateDb.RawDump(), nil
-		}
-		var block *types.Block
-		if blockNr == rpc.LatestBlockNumber {
-			block = api.eth.blockchain.CurrentBlock()
-		} else {
-			block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
-		}
-		if block == nil {
-			return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
-		}
-		stateDb, err := api.eth.BlockChain().StateAt(block.Root())
-		if err != nil {
-			return state.Dump{}, err
-		}
-		return stateDb.RawDump(), nil
-	*/
-	return state.Dump{}, ErrNotImplemented
+func (api *PublicDebugChainAPI) DumpBlock(blockNr rpc.BlockNumber) (*bstate.Dump, error) {
+	return api.eth.state.Dump(blockIndexOf(blockNr), nil, 0)
+}
+
+// AccountRange retrieves up to maxResults accounts of the state at a given
+// block, starting from the given hashed address. The returned dump includes
+// the hash from which to continue, if there are more accounts.
+func (api *PublicDebugChainAPI) AccountRange(blockNr rpc.BlockNumber, start hexutil.Bytes, maxResults int) (*bstate.Dump, error) {
+	if maxResults <= 0 {
+		return nil, fmt.Errorf("maxResults must be positive")
+	}
+	return api.eth.state.Dump(blockIndexOf(blockNr), start, maxResults)
+}
+
+// blockIndexOf converts a block number to a block index, where the latest and
+// pending blocks are negative
+func blockIndexOf(blockNr rpc.BlockNumber) int64 {
+	if blockNr < 0 {
+		return -1
+	}
+	return blockNr.Int64()
 }
 
 // PrivateDebugChainAPI is the collection of Ethereum full node APIs exposed over
@@ -231,13 +183,7 @@ func NewPrivateDebugChainAPI(config *params.ChainConfig, eth *Service) *PrivateD
 
 // Preimage is a debug API function that returns the preimage for a sha3 hash, if known.
 func (api *PrivateDebugChainAPI) Preimage(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
-	/*
-		if preimage := rawdb.ReadPreimage(api.eth.ChainDb(), hash); preimage != nil {
-			return preimage, nil
-		}
-		return nil, errors.New("unknown preimage")
-	*/
-	return nil, ErrNotImplemented
+	return api.eth.state.GetPreimage(hash)
 }
 
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
@@ -288,18 +234,15 @@ type storageEntry struct {
 
 // StorageRangeAt returns the storage at the given block height and transaction index.
 func (api *PrivateDebugChainAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
-	/*
-		_, _, statedb, err := api.computeTxEnv(blockHash, txIndex, 0)
-		if err != nil {
-			return StorageRangeResult{}, err
-		}
-		st := statedb.StorageTrie(contractAddress)
-		if st == nil {
-			return StorageRangeResult{}, fmt.Errorf("account %x doesn't exist", contractAddress)
-		}
-		return storageRangeAt(st, keyStart, maxResult)
-	*/
-	return StorageRangeResult{}, ErrNotImplemented
+	block, err := api.eth.state.GetBlock(blockHash)
+	if err != nil {
+		return StorageRangeResult{}, fmt.Errorf("block %x not found", blockHash)
+	}
+	st, err := api.eth.state.StorageTrieAt(block.Index(), txIndex, contractAddress)
+	if err != nil {
+		return StorageRangeResult{}, err
+	}
+	return storageRangeAt(st, keyStart, maxResult)
 }
 
 func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeResult, error) {
@@ -331,29 +274,13 @@ func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeRes
 //
 // With one parameter, returns the list of accounts modified in the specified block.
 func (api *PrivateDebugChainAPI) GetModifiedAccountsByNumber(startNum uint64, endNum *uint64) ([]common.Address, error) {
-	/*
-		var startBlock, endBlock *types.Block
-
-		startBlock = api.eth.blockchain.GetBlockByNumber(startNum)
-		if startBlock == nil {
-			return nil, fmt.Errorf("start block %x not found", startNum)
-		}
-
-		if endNum == nil {
-			endBlock = startBlock
-			startBlock = api.eth.blockchain.GetBlockByHash(startBlock.ParentHash())
-			if startBlock == nil {
-				return nil, fmt.Errorf("block %x has no parent", endBlock.Number())
-			}
-		} else {
-			endBlock = api.eth.blockchain.GetBlockByNumber(*endNum)
-			if endBlock == nil {
-				return nil, fmt.Errorf("end block %d not found", *endNum)
-			}
-		}
-		return api.getModifiedAccounts(startBlock, endBlock)
-	*/
-	return nil, ErrNotImplemented
+	startIndex, endIndex := int64(startNum), int64(startNum)
+	if endNum == nil {
+		startIndex--
+	} else {
+		endIndex = int64(*endNum)
+	}
+	return api.eth.state.GetModifiedAccounts(startIndex, endIndex)
 }
 
 // GetModifiedAccountsByHash returns all accounts that have changed between the
@@ -362,57 +289,20 @@ func (api *PrivateDebugChainAPI) GetModifiedAccountsByNumber(startNum uint64, en
 //
 // With one parameter, returns the list of accounts modified in the specified block.
 func (api *PrivateDebugChainAPI) GetModifiedAccountsByHash(startHash common.Hash, endHash *common.Hash) ([]common.Address, error) {
-	/*
-		var startBlock, endBlock *types.Block
-		startBlock = api.eth.blockchain.GetBlockByHash(startHash)
-		if startBlock == nil {
-			return nil, fmt.Errorf("start block %x not found", startHash)
-		}
-
-		if endHash == nil {
-			endBlock = startBlock
-			startBlock = api.eth.blockchain.GetBlockByHash(startBlock.ParentHash())
-			if startBlock == nil {
-				return nil, fmt.Errorf("block %x has no parent", endBlock.Number())
-			}
-		} else {
-			endBlock = api.eth.blockchain.GetBlockByHash(*endHash)
-			if endBlock == nil {
-				return nil, fmt.Errorf("end block %x not found", *endHash)
-			}
-		}
-		return api.getModifiedAccounts(startBlock, endBlock)
-	*/
-	return nil, ErrNotImplemented
-}
-
-func (api *PrivateDebugChainAPI) getModifiedAccounts(startBlock, endBlock *types.Block) ([]common.Address, error) {
-	/*
-		if startBlock.Number().Uint64() >= endBlock.Number().Uint64() {
-			return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startBlock.Number().Uint64(), endBlock.Number().Uint64())
-		}
+	startBlock, err := api.eth.state.GetBlock(startHash)
+	if err != nil {
+		return nil, fmt.Errorf("start block %x not found", startHash)
+	}
+	startIndex, endIndex := startBlock.Index(), startBlock.Index()
 
-		oldTrie, err := trie.NewSecure(startBlock.Root(), trie.NewDatabase(api.eth.chainDb), 0)
-		if err != nil {
-			return nil, err
-		}
-		newTrie, err := trie.NewSecure(endBlock.Root(), trie.NewDatabase(api.eth.chainDb), 0)
+	if endHash == nil {
+		startIndex--
+	} else {
+		endBlock, err := api.eth.state.GetBlock(*endHash)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("end block %x not found", *endHash)
 		}
-
-		diff, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator([]byte{}), newTrie.NodeIterator([]byte{}))
-		iter := trie.NewIterator(diff)
-
-		var dirty []common.Address
-		for iter.Next() {
-			key := newTrie.GetKey(iter.Key)
-			if key == nil {
-				return nil, fmt.Errorf("no preimage found for hash %x", iter.Key)
-			}
-			dirty = append(dirty, common.BytesToAddress(key))
-		}
-		return dirty, nil
-	*/
-	return nil, ErrNotImplemented
+		endIndex = endBlock.Index()
+	}
+	return api.eth.state.GetModifiedAccounts(startIndex, endIndex)
 }
@@ -50,11 +50,11 @@ func (s *Web3ChainService) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicDebugChainAPI(s.backend),
 			Public:    true,
-		}, /*{
+		}, {
 			Namespace: "debug",
 			Version:   "1.0",
-			Service:   NewPrivateDebugChainAPI(s.chainConfig, s),
-		},*/ /*{
+			Service:   NewPrivateDebugChainAPI(s.backend.chainConfig, s.backend),
+		}, /*{
 			Namespace: "net",
 			Version:   "1.0",
 			Service:   s.netRPCService,
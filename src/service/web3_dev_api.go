@@ -0,0 +1,140 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/Fantom-foundation/go-evm/src/state"
+)
+
+// DevBackend is implemented by consensus systems which let developers control
+// block production, time, and the chain head. Only Solo consensus does.
+type DevBackend interface {
+	// Mine produces a block with the pending transactions, if any
+	Mine() error
+
+	// IncreaseTime shifts the timestamp of future blocks by the given number
+	// of seconds, and returns the total shift
+	IncreaseTime(seconds int64) int64
+
+	// SetNextBlockTimestamp sets the timestamp of the next block
+	SetNextBlockTimestamp(timestamp int64) error
+
+	// Snapshot records the state root and chain head, and returns an id with
+	// which to revert to them
+	Snapshot() (uint64, error)
+
+	// Revert restores the state root and chain head recorded by a snapshot.
+	// The snapshot, and all the ones taken after it, are discarded. It returns
+	// false if the snapshot doesn't exist.
+	Revert(id uint64) (bool, error)
+}
+
+// EnableDevAPI registers the developer RPC namespaces, backed by the consensus
+// system, and lets them modify the State directly. It must be called before the
+// Service is run.
+func (m *Service) EnableDevAPI(dev DevBackend) error {
+	m.state.EnableDevMode()
+	return m.rpcServer.Register(NewWeb3DevServiceConstructor(m, dev))
+}
+
+// PublicDevAPI provides ganache-style methods to control a development node
+type PublicDevAPI struct {
+	dev DevBackend
+}
+
+// NewPublicDevAPI creates a new developer API
+func NewPublicDevAPI(dev DevBackend) *PublicDevAPI {
+	return &PublicDevAPI{dev}
+}
+
+// Mine forces a block to be produced
+func (api *PublicDevAPI) Mine() (string, error) {
+	if err := api.dev.Mine(); err != nil {
+		return "", err
+	}
+	return "0x0", nil
+}
+
+// IncreaseTime shifts the timestamp of future blocks by the given number of
+// seconds, and returns the total shift
+func (api *PublicDevAPI) IncreaseTime(seconds int64) int64 {
+	return api.dev.IncreaseTime(seconds)
+}
+
+// SetNextBlockTimestamp sets the timestamp of the next block
+func (api *PublicDevAPI) SetNextBlockTimestamp(timestamp int64) error {
+	return api.dev.SetNextBlockTimestamp(timestamp)
+}
+
+// Snapshot records the state of the chain and returns its id
+func (api *PublicDevAPI) Snapshot() (hexutil.Uint64, error) {
+	id, err := api.dev.Snapshot()
+	return hexutil.Uint64(id), err
+}
+
+// Revert restores the state of the chain recorded by the snapshot with the
+// given id
+func (api *PublicDevAPI) Revert(id hexutil.Uint64) (bool, error) {
+	return api.dev.Revert(uint64(id))
+}
+
+// PublicDevStateAPI provides methods to modify accounts directly, and to send
+// transactions on behalf of accounts without their private keys
+type PublicDevStateAPI struct {
+	state *state.State
+}
+
+// NewPublicDevStateAPI creates a new developer API to modify the State
+func NewPublicDevStateAPI(state *state.State) *PublicDevStateAPI {
+	return &PublicDevStateAPI{state}
+}
+
+// SetBalance overwrites the balance of an account
+func (api *PublicDevStateAPI) SetBalance(address common.Address, balance hexutil.Big) (bool, error) {
+	if err := api.state.SetBalance(address, balance.ToInt()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetCode overwrites the code of an account
+func (api *PublicDevStateAPI) SetCode(address common.Address, code hexutil.Bytes) (bool, error) {
+	if err := api.state.SetCode(address, code); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetStorageAt overwrites a storage slot of an account
+func (api *PublicDevStateAPI) SetStorageAt(address common.Address, key common.Hash, value common.Hash) (bool, error) {
+	if err := api.state.SetStorageAt(address, key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetNonce overwrites the nonce of an account
+func (api *PublicDevStateAPI) SetNonce(address common.Address, nonce hexutil.Uint64) (bool, error) {
+	if err := api.state.SetNonce(address, uint64(nonce)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ImpersonateAccount lets eth_sendTransaction and the /tx endpoint send
+// unsigned transactions on behalf of the given account
+func (api *PublicDevStateAPI) ImpersonateAccount(address common.Address) (bool, error) {
+	if err := api.state.ImpersonateAccount(address); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StopImpersonatingAccount reverts the effect of ImpersonateAccount
+func (api *PublicDevStateAPI) StopImpersonatingAccount(address common.Address) (bool, error) {
+	if err := api.state.StopImpersonatingAccount(address); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type Web3DevService struct {
+	backend *Service
+	dev     DevBackend
+}
+
+func NewWeb3DevServiceConstructor(backend *Service, dev DevBackend) RpcServiceConstructor {
+	return func(context *RpcServiceContext) (RpcService, error) {
+		return &Web3DevService{
+			backend: backend,
+			dev:     dev,
+		}, nil
+	}
+}
+
+func (s *Web3DevService) Start() error {
+	return nil
+}
+
+func (s *Web3DevService) Stop() error {
+	return nil
+}
+
+func (s *Web3DevService) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "evm",
+			Version:   "1.0",
+			Service:   NewPublicDevAPI(s.dev),
+			Public:    true,
+		},
+		{
+			Namespace: "dev",
+			Version:   "1.0",
+			Service:   NewPublicDevStateAPI(s.backend.state),
+			Public:    true,
+		},
+	}
+}
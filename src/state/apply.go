@@ -0,0 +1,103 @@
+package state
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// blockContext holds the information about the block in which transactions
+// are executed, as exposed to the EVM.
+type blockContext struct {
+	Hash  common.Hash
+	Index int64
+	Time  int64
+}
+
+// newVMContext creates the EVM context in which a message is executed
+func newVMContext(msg core.Message, block blockContext) vm.Context {
+	return vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return block.Hash },
+		// Message information
+		Origin:      msg.From(),
+		GasLimit:    msg.Gas(),
+		GasPrice:    msg.GasPrice(),
+		BlockNumber: big.NewInt(block.Index),
+		Time:        big.NewInt(block.Time),
+		Difficulty:  big.NewInt(0),
+	}
+}
+
+// applyMessage executes a message on the given StateDB, and returns the
+// corresponding receipt along with the data returned by the EVM. usedGas is the
+// gas used so far in the block; it is updated with the gas used by the message.
+//
+// If the message cannot be applied (nonce, balance, gas limit...), the StateDB
+// and the GasPool are reverted to what they were before the call, and the error
+// is returned. Otherwise the message was executed, even if the EVM execution
+// itself failed (revert, out of gas...), which the receipt status reflects.
+func applyMessage(statedb *ethState.StateDB,
+	chainConfig *params.ChainConfig,
+	vmConfig vm.Config,
+	gp *core.GasPool,
+	usedGas *uint64,
+	block blockContext,
+	msg core.Message,
+	txHash common.Hash,
+	txIndex int) (*ethTypes.Receipt, []byte, error) {
+
+	//Prepare the StateDB with the transaction hash so that it can be used in
+	//emitted logs
+	statedb.Prepare(txHash, block.Hash, txIndex)
+
+	snapshot := statedb.Snapshot()
+	availableGas := gp.Gas()
+
+	// The EVM should never be reused and is not thread safe.
+	vmenv := vm.NewEVM(newVMContext(msg, block), statedb, chainConfig, vmConfig)
+
+	// Apply the message to the current state (included in the env)
+	ret, gas, failed, err := core.ApplyMessage(vmenv, msg, gp)
+	if err != nil {
+		statedb.RevertToSnapshot(snapshot)
+		*gp = core.GasPool(availableGas)
+		return nil, nil, err
+	}
+
+	*usedGas += gas
+
+	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
+	// based on the eip phase, we're passing whether the root touch-delete accounts.
+	root := statedb.IntermediateRoot(true) //this has side effects. It updates StateObjects (SmartContract memory)
+	receipt := ethTypes.NewReceipt(root.Bytes(), failed, *usedGas)
+	receipt.TxHash = txHash
+	receipt.GasUsed = gas
+	// if the transaction created a contract, store the creation address in the receipt.
+	if msg.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), msg.Nonce())
+	}
+	// Set the receipt logs and create a bloom for filtering
+	receipt.Logs = statedb.GetLogs(txHash)
+	receipt.Bloom = ethTypes.CreateBloom(ethTypes.Receipts{receipt})
+
+	return receipt, ret, nil
+}
+
+// newFailedReceipt creates the receipt of a transaction which could not be
+// applied at all. It consumes no gas and leaves the state untouched.
+func newFailedReceipt(statedb *ethState.StateDB, usedGas uint64, txHash common.Hash) *ethTypes.Receipt {
+	root := statedb.IntermediateRoot(true)
+	receipt := ethTypes.NewReceipt(root.Bytes(), true, usedGas)
+	receipt.TxHash = txHash
+	receipt.Logs = []*ethTypes.Log{}
+	receipt.Bloom = ethTypes.CreateBloom(ethTypes.Receipts{receipt})
+	return receipt
+}
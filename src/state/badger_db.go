@@ -0,0 +1,153 @@
+package state
+
+import (
+	"errors"
+	"os"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// BadgerDatabase is an ethdb.Database stored in a Badger directory
+type BadgerDatabase struct {
+	db *badger.DB
+}
+
+//NewBadgerDatabase opens, or creates, a Badger database in the given directory
+func NewBadgerDatabase(dir string) (*BadgerDatabase, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = dir
+	opts.SyncWrites = false
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerDatabase{db: db}, nil
+}
+
+//Put stores a value under a key
+func (b *BadgerDatabase) Put(key []byte, value []byte) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(common.CopyBytes(key), common.CopyBytes(value))
+	})
+}
+
+//Get returns the value stored under a key, or an error if there is none
+func (b *BadgerDatabase) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+//Has reports whether a value is stored under a key
+func (b *BadgerDatabase) Has(key []byte) (bool, error) {
+	_, err := b.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Delete removes a key
+func (b *BadgerDatabase) Delete(key []byte) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(common.CopyBytes(key))
+	})
+}
+
+//Close closes the database
+func (b *BadgerDatabase) Close() {
+	b.db.Close()
+}
+
+//NewBatch returns a batch of writes, applied by its Write method
+func (b *BadgerDatabase) NewBatch() ethdb.Batch {
+	return &badgerBatch{db: b.db}
+}
+
+// badgerOp is a write of a badgerBatch
+type badgerOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// badgerBatch buffers writes until they are applied by Write
+type badgerBatch struct {
+	db   *badger.DB
+	ops  []badgerOp
+	size int
+}
+
+func (b *badgerBatch) Put(key, value []byte) error {
+	b.ops = append(b.ops, badgerOp{key: common.CopyBytes(key), value: common.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *badgerBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, badgerOp{key: common.CopyBytes(key), delete: true})
+	b.size++
+	return nil
+}
+
+func (b *badgerBatch) ValueSize() int {
+	return b.size
+}
+
+//Write applies the writes of the batch. A Badger transaction has a maximum
+//size, so large batches are split into several transactions.
+func (b *badgerBatch) Write() error {
+	ops := b.ops
+	for len(ops) > 0 {
+		applied := 0
+		err := b.db.Update(func(txn *badger.Txn) error {
+			for _, op := range ops {
+				var err error
+				if op.delete {
+					err = txn.Delete(op.key)
+				} else {
+					err = txn.Set(op.key, op.value)
+				}
+				if err == badger.ErrTxnTooBig {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				applied++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if applied == 0 {
+			return errors.New("batch entry too large for a badger transaction")
+		}
+		ops = ops[applied:]
+	}
+	return nil
+}
+
+func (b *badgerBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
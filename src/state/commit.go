@@ -0,0 +1,83 @@
+package state
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/sirupsen/logrus"
+)
+
+//writeCommit completes a batch with the head pointers (root and head block) and
+//the commit marker, and writes it. The marker is the last entry of the batch,
+//so it is only present once everything else is, even with backends which split
+//large batches.
+func (s *State) writeCommit(batch ethdb.Batch, blockIndex int64, root common.Hash) error {
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(blockIndex))
+
+	if err := batch.Put(rootKey, root.Bytes()); err != nil {
+		return err
+	}
+	if err := batch.Put(headBlockKey, index); err != nil {
+		return err
+	}
+	if err := batch.Put(lastCommitKey, append(index, root.Bytes()...)); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+//lastCommit returns the block index and root of the commit marker. ok is false
+//if there is no marker, as in databases written before it was introduced.
+func (s *State) lastCommit() (blockIndex int64, root common.Hash, ok bool) {
+	data, err := s.db.Get(lastCommitKey)
+	if err != nil || len(data) != 8+common.HashLength {
+		return 0, common.Hash{}, false
+	}
+	return int64(binary.BigEndian.Uint64(data[:8])), common.BytesToHash(data[8:]), true
+}
+
+//repairCommit detects a commit which was interrupted after writing some of its
+//entries, and rolls it back to the last full commit: entries of the blocks
+//above the marker are deleted, and the head pointers are restored.
+func (s *State) repairCommit() error {
+	blockIndex, root, ok := s.lastCommit()
+	if !ok {
+		return nil
+	}
+
+	batch := s.db.NewBatch()
+	partial := false
+
+	for index := blockIndex + 1; ; index++ {
+		_, errBlock := s.db.Get(blockKey(index))
+		_, errRoot := s.db.Get(blockRootKey(index))
+		if errBlock != nil && errRoot != nil {
+			break
+		}
+		if err := s.deleteBlock(batch, index); err != nil {
+			return err
+		}
+		partial = true
+	}
+
+	if s.GetRoot() != root {
+		partial = true
+	}
+	data, _ := s.db.Get(headBlockKey)
+	if len(data) != 8 || int64(binary.BigEndian.Uint64(data)) != blockIndex {
+		partial = true
+	}
+
+	if !partial {
+		return nil
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block": blockIndex,
+		"root":  root.Hex(),
+	}).Warn("Repairing partial commit")
+
+	return s.writeCommit(batch, blockIndex, root)
+}
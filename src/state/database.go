@@ -0,0 +1,49 @@
+package state
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Storage backends of the State database
+const (
+	// LevelDBBackend stores the database in a LevelDB directory
+	LevelDBBackend = "leveldb"
+	// MemoryBackend keeps the database in memory. Nothing survives a restart,
+	// which suits tests and ephemeral development chains.
+	MemoryBackend = "memory"
+	// BadgerBackend stores the database in a Badger directory
+	BadgerBackend = "badger"
+)
+
+//NewDatabase opens the database of a State with the given backend. dbFile is
+//the directory of persistent backends, and dbCache the megabytes of memory they
+//may use for caching.
+func NewDatabase(backend string, dbFile string, dbCache int) (ethdb.Database, error) {
+	switch backend {
+	case LevelDBBackend, "":
+		handles, err := getFdLimit()
+		if err != nil {
+			return nil, err
+		}
+		return ethdb.NewLDBDatabase(dbFile, dbCache, handles)
+	case MemoryBackend:
+		return ethdb.NewMemDatabase(), nil
+	case BadgerBackend:
+		return NewBadgerDatabase(dbFile)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", backend)
+	}
+}
+
+// getFdLimit retrieves the number of file descriptors allowed to be opened by this
+// process.
+func getFdLimit() (int, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+	return int(limit.Cur), nil
+}
@@ -0,0 +1,200 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrDevModeDisabled is returned by the developer methods of the State when
+	// dev mode has not been enabled by the consensus system.
+	ErrDevModeDisabled = errors.New("dev mode is disabled")
+
+	// ErrNotImpersonated is returned when trying to build a transaction on
+	// behalf of an account which is not impersonated.
+	ErrNotImpersonated = errors.New("account is not impersonated")
+
+	// impersonationS is the S value of the placeholder signature carried by
+	// transactions sent from impersonated accounts. The R value holds the
+	// address of the sender.
+	impersonationS = big.NewInt(1)
+)
+
+//EnableDevMode allows the developer methods below to modify the state directly,
+//and to execute transactions on behalf of impersonated accounts. Only Solo
+//consensus enables it, since other nodes would not see the same changes.
+func (s *State) EnableDevMode() {
+	s.devMutex.Lock()
+	defer s.devMutex.Unlock()
+
+	s.devMode = true
+	if s.impersonated == nil {
+		s.impersonated = make(map[common.Address]bool)
+	}
+}
+
+//modify applies a change to the WAS StateDB and commits it. The change is not
+//part of any block, so the head block's recorded root is left untouched.
+func (s *State) modify(change func(statedb *ethState.StateDB)) error {
+	s.devMutex.RLock()
+	devMode := s.devMode
+	s.devMutex.RUnlock()
+	if !devMode {
+		return ErrDevModeDisabled
+	}
+
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	change(s.was.ethState)
+
+	_, err := s.Commit()
+	return err
+}
+
+//SetBalance overwrites the balance of an account
+func (s *State) SetBalance(addr common.Address, balance *big.Int) error {
+	s.logger.WithFields(logrus.Fields{
+		"address": addr.Hex(),
+		"balance": balance,
+	}).Debug("SetBalance")
+
+	return s.modify(func(statedb *ethState.StateDB) {
+		statedb.SetBalance(addr, balance)
+	})
+}
+
+//SetCode overwrites the code of an account
+func (s *State) SetCode(addr common.Address, code []byte) error {
+	s.logger.WithField("address", addr.Hex()).Debug("SetCode")
+
+	return s.modify(func(statedb *ethState.StateDB) {
+		statedb.SetCode(addr, code)
+	})
+}
+
+//SetStorageAt overwrites a storage slot of an account
+func (s *State) SetStorageAt(addr common.Address, key common.Hash, value common.Hash) error {
+	s.logger.WithFields(logrus.Fields{
+		"address": addr.Hex(),
+		"key":     key.Hex(),
+		"value":   value.Hex(),
+	}).Debug("SetStorageAt")
+
+	return s.modify(func(statedb *ethState.StateDB) {
+		statedb.SetState(addr, key, value)
+	})
+}
+
+//SetNonce overwrites the nonce of an account
+func (s *State) SetNonce(addr common.Address, nonce uint64) error {
+	s.logger.WithFields(logrus.Fields{
+		"address": addr.Hex(),
+		"nonce":   nonce,
+	}).Debug("SetNonce")
+
+	return s.modify(func(statedb *ethState.StateDB) {
+		statedb.SetNonce(addr, nonce)
+	})
+}
+
+//ImpersonateAccount lets transactions be sent on behalf of an account without
+//its private key
+func (s *State) ImpersonateAccount(addr common.Address) error {
+	s.devMutex.Lock()
+	defer s.devMutex.Unlock()
+
+	if !s.devMode {
+		return ErrDevModeDisabled
+	}
+	s.impersonated[addr] = true
+
+	s.logger.WithField("address", addr.Hex()).Debug("ImpersonateAccount")
+
+	return nil
+}
+
+//StopImpersonatingAccount reverts the effect of ImpersonateAccount
+func (s *State) StopImpersonatingAccount(addr common.Address) error {
+	s.devMutex.Lock()
+	defer s.devMutex.Unlock()
+
+	if !s.devMode {
+		return ErrDevModeDisabled
+	}
+	delete(s.impersonated, addr)
+
+	s.logger.WithField("address", addr.Hex()).Debug("StopImpersonatingAccount")
+
+	return nil
+}
+
+//IsImpersonated reports whether transactions can be sent on behalf of the given
+//account without its private key
+func (s *State) IsImpersonated(addr common.Address) bool {
+	s.devMutex.RLock()
+	defer s.devMutex.RUnlock()
+
+	return s.devMode && s.impersonated[addr]
+}
+
+//ImpersonatedTx attaches a placeholder signature to an unsigned transaction sent
+//from an impersonated account. The signature encodes the sender, so that
+//identical transactions sent from different accounts have different hashes, and
+//so that the sender can be known when the transaction is applied.
+func (s *State) ImpersonatedTx(tx *ethTypes.Transaction, from common.Address) (*ethTypes.Transaction, error) {
+	if !s.IsImpersonated(from) {
+		return nil, ErrNotImpersonated
+	}
+
+	sig := make([]byte, 65)
+	copy(sig[12:32], from.Bytes())
+	copy(sig[32:64], common.LeftPadBytes(impersonationS.Bytes(), 32))
+
+	return tx.WithSignature(s.signer, sig)
+}
+
+//impersonatedSender returns the sender encoded in the placeholder signature of a
+//transaction created by ImpersonatedTx, provided the sender is still
+//impersonated.
+func (s *State) impersonatedSender(tx *ethTypes.Transaction) (common.Address, bool) {
+	_, r, sv := tx.RawSignatureValues()
+	if sv.Cmp(impersonationS) != 0 || r.BitLen() > 8*common.AddressLength {
+		return common.Address{}, false
+	}
+	from := common.BigToAddress(r)
+	if !s.IsImpersonated(from) {
+		return common.Address{}, false
+	}
+	return from, true
+}
+
+//Sender returns the address of the account which sent a transaction, be it
+//signed or sent from an impersonated account.
+func (s *State) Sender(tx *ethTypes.Transaction) (common.Address, error) {
+	if from, ok := s.impersonatedSender(tx); ok {
+		return from, nil
+	}
+	return ethTypes.Sender(s.signer, tx)
+}
+
+//asMessage converts a transaction into the message executed by the EVM
+func (s *State) asMessage(tx *ethTypes.Transaction) (ethTypes.Message, error) {
+	from, ok := s.impersonatedSender(tx)
+	if !ok {
+		return tx.AsMessage(s.signer)
+	}
+	return ethTypes.NewMessage(from,
+		tx.To(),
+		tx.Nonce(),
+		tx.Value(),
+		tx.Gas(),
+		tx.GasPrice(),
+		tx.Data(),
+		true), nil
+}
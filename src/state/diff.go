@@ -0,0 +1,294 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// StateDiff lists the accounts which differ between two states, ordered by
+// address
+type StateDiff []AccountDiff
+
+// AccountDiff describes how an account changed. Before is nil if the account
+// was created, and After is nil if it was deleted.
+type AccountDiff struct {
+	Address common.Address `json:"address"`
+	Before  *AccountState  `json:"before"`
+	After   *AccountState  `json:"after"`
+	Storage []StorageDiff  `json:"storage,omitempty"`
+}
+
+// AccountState holds the fields of an account
+type AccountState struct {
+	Nonce   hexutil.Uint64 `json:"nonce"`
+	Balance *hexutil.Big   `json:"balance"`
+	Code    hexutil.Bytes  `json:"code"`
+}
+
+// StorageDiff describes how a storage slot changed. Missing slots have a zero
+// value.
+type StorageDiff struct {
+	Key    common.Hash `json:"key"`
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+// Addresses returns the addresses of the accounts in the diff
+func (d StateDiff) Addresses() []common.Address {
+	addresses := make([]common.Address, len(d))
+	for i, account := range d {
+		addresses[i] = account.Address
+	}
+	return addresses
+}
+
+//leafDifference returns the leaves of trie b which are not in trie a, keyed by
+//the preimage of their hashed keys (left padded addresses for account tries)
+func leafDifference(a, b ethState.Trie) (map[common.Hash][]byte, error) {
+	it, _ := trie.NewDifferenceIterator(a.NodeIterator(nil), b.NodeIterator(nil))
+	leaves := trie.NewIterator(it)
+
+	res := make(map[common.Hash][]byte)
+	for leaves.Next() {
+		preimage := b.GetKey(leaves.Key)
+		if preimage == nil {
+			return nil, fmt.Errorf("missing preimage of key %x", leaves.Key)
+		}
+		res[common.BytesToHash(preimage)] = common.CopyBytes(leaves.Value)
+	}
+	if leaves.Err != nil {
+		return nil, leaves.Err
+	}
+	return res, nil
+}
+
+//diffStates compares two states by iterating over the differences between their
+//account tries, and between the storage tries of the accounts which changed.
+//Both states must be present in the database.
+func diffStates(db ethState.Database, oldRoot, newRoot common.Hash) (StateDiff, error) {
+	oldTrie, err := db.OpenTrie(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := db.OpenTrie(newRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := leafDifference(newTrie, oldTrie)
+	if err != nil {
+		return nil, err
+	}
+	added, err := leafDifference(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[common.Hash]bool)
+	for key := range removed {
+		keys[key] = true
+	}
+	for key := range added {
+		keys[key] = true
+	}
+
+	diff := make(StateDiff, 0, len(keys))
+	for key := range keys {
+		address := common.BytesToAddress(key[common.HashLength-common.AddressLength:])
+		before, err := decodeAccount(removed[key])
+		if err != nil {
+			return nil, err
+		}
+		after, err := decodeAccount(added[key])
+		if err != nil {
+			return nil, err
+		}
+
+		accountDiff, err := diffAccount(db, address, before, after)
+		if err != nil {
+			return nil, err
+		}
+		diff = append(diff, accountDiff)
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		return bytes.Compare(diff[i].Address[:], diff[j].Address[:]) < 0
+	})
+
+	return diff, nil
+}
+
+//decodeAccount decodes an RLP encoded account. It returns nil if there is no
+//account.
+func decodeAccount(data []byte) (*ethState.Account, error) {
+	if data == nil {
+		return nil, nil
+	}
+	account := new(ethState.Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+//diffAccount builds the diff of an account, given its state in the old and new
+//account tries
+func diffAccount(db ethState.Database, address common.Address, before, after *ethState.Account) (AccountDiff, error) {
+	addrHash := crypto.Keccak256Hash(address[:])
+	res := AccountDiff{Address: address}
+
+	oldStorageRoot, newStorageRoot := emptyRoot, emptyRoot
+	var err error
+	if before != nil {
+		oldStorageRoot = before.Root
+		if res.Before, err = accountState(db, addrHash, before); err != nil {
+			return res, err
+		}
+	}
+	if after != nil {
+		newStorageRoot = after.Root
+		if res.After, err = accountState(db, addrHash, after); err != nil {
+			return res, err
+		}
+	}
+
+	if oldStorageRoot == newStorageRoot {
+		return res, nil
+	}
+
+	oldStorage, err := db.OpenStorageTrie(addrHash, oldStorageRoot)
+	if err != nil {
+		return res, err
+	}
+	newStorage, err := db.OpenStorageTrie(addrHash, newStorageRoot)
+	if err != nil {
+		return res, err
+	}
+
+	removed, err := leafDifference(newStorage, oldStorage)
+	if err != nil {
+		return res, err
+	}
+	added, err := leafDifference(oldStorage, newStorage)
+	if err != nil {
+		return res, err
+	}
+
+	slots := make(map[common.Hash]*StorageDiff)
+	for key, value := range removed {
+		v, err := decodeStorage(value)
+		if err != nil {
+			return res, err
+		}
+		slots[key] = &StorageDiff{Key: key, Before: v}
+	}
+	for key, value := range added {
+		v, err := decodeStorage(value)
+		if err != nil {
+			return res, err
+		}
+		if slot, ok := slots[key]; ok {
+			slot.After = v
+		} else {
+			slots[key] = &StorageDiff{Key: key, After: v}
+		}
+	}
+
+	for _, slot := range slots {
+		res.Storage = append(res.Storage, *slot)
+	}
+	sort.Slice(res.Storage, func(i, j int) bool {
+		return bytes.Compare(res.Storage[i].Key[:], res.Storage[j].Key[:]) < 0
+	})
+
+	return res, nil
+}
+
+//accountState loads the code of an account along with its nonce and balance
+func accountState(db ethState.Database, addrHash common.Hash, account *ethState.Account) (*AccountState, error) {
+	res := &AccountState{
+		Nonce:   hexutil.Uint64(account.Nonce),
+		Balance: (*hexutil.Big)(account.Balance),
+	}
+	if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCodeHash {
+		code, err := db.ContractCode(addrHash, codeHash)
+		if err != nil {
+			return nil, err
+		}
+		res.Code = code
+	}
+	return res, nil
+}
+
+//decodeStorage decodes an RLP encoded storage value. Missing values are zero.
+func decodeStorage(data []byte) (common.Hash, error) {
+	if len(data) == 0 {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(data)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+//writeStateDiff adds to a batch the changes made by a block, given the state
+//roots before and after it
+func (s *State) writeStateDiff(batch ethdb.Putter, blockIndex int64, parentRoot, root common.Hash) error {
+	diff, err := diffStates(s.was.ethState.Database(), parentRoot, root)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	return batch.Put(blockDiffKey(blockIndex), data)
+}
+
+//GetStateDiff returns the changes made by the block with the given index. It is
+//only available if state diffs were recorded when the block was processed.
+func (s *State) GetStateDiff(blockIndex int64) (StateDiff, error) {
+	data, err := s.db.Get(blockDiffKey(blockIndex))
+	if err != nil {
+		return nil, fmt.Errorf("no state diff recorded for block %d", blockIndex)
+	}
+	var diff StateDiff
+	if err := json.Unmarshal(data, &diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+//GetModifiedAccounts returns the addresses of the accounts which differ between
+//the states after startIndex and endIndex blocks
+func (s *State) GetModifiedAccounts(startIndex, endIndex int64) ([]common.Address, error) {
+	if startIndex >= endIndex {
+		return nil, fmt.Errorf("start block index (%d) must be less than end block index (%d)",
+			startIndex, endIndex)
+	}
+	startRoot, err := s.GetBlockRoot(startIndex)
+	if err != nil {
+		return nil, fmt.Errorf("no state root recorded for block %d", startIndex)
+	}
+	endRoot, err := s.GetBlockRoot(endIndex)
+	if err != nil {
+		return nil, fmt.Errorf("no state root recorded for block %d", endIndex)
+	}
+
+	diff, err := diffStates(s.ethState.Database(), startRoot, endRoot)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Addresses(), nil
+}
@@ -0,0 +1,190 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Dump lists accounts of the state after a block, keyed by the hash of their
+// address, which is the order in which they are stored. Next is the hash from
+// which to continue listing accounts, or nil if the dump is complete.
+type Dump struct {
+	Root     common.Hash                 `json:"root"`
+	Accounts map[common.Hash]DumpAccount `json:"accounts"`
+	Next     *common.Hash                `json:"next"`
+}
+
+// DumpAccount is an account of a Dump. Address is nil if its preimage is
+// unknown. Storage is keyed by the hash of the slot keys.
+type DumpAccount struct {
+	Address  *common.Address                  `json:"address"`
+	Balance  *hexutil.Big                     `json:"balance"`
+	Nonce    hexutil.Uint64                   `json:"nonce"`
+	Root     common.Hash                      `json:"root"`
+	CodeHash common.Hash                      `json:"codeHash"`
+	Code     hexutil.Bytes                    `json:"code"`
+	Storage  map[common.Hash]DumpStorageEntry `json:"storage"`
+}
+
+// DumpStorageEntry is a storage slot of a DumpAccount. Key is nil if its
+// preimage is unknown.
+type DumpStorageEntry struct {
+	Key   *common.Hash `json:"key"`
+	Value common.Hash  `json:"value"`
+}
+
+//rootAt returns the state root after the block with the given index, or the
+//root of the last commit if blockIndex is negative
+func (s *State) rootAt(blockIndex int64) (common.Hash, error) {
+	if blockIndex < 0 {
+		return s.GetRoot(), nil
+	}
+	root, err := s.GetBlockRoot(blockIndex)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("no state root recorded for block %d", blockIndex)
+	}
+	return root, nil
+}
+
+//Dump lists up to maxResults accounts of the state after the given block (the
+//last one if blockIndex is negative), starting from the given hashed address.
+//All accounts are listed if maxResults is not positive.
+func (s *State) Dump(blockIndex int64, start []byte, maxResults int) (*Dump, error) {
+	root, err := s.rootAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.ethState.Database()
+	accTrie, err := db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &Dump{
+		Root:     root,
+		Accounts: make(map[common.Hash]DumpAccount),
+	}
+
+	it := trie.NewIterator(accTrie.NodeIterator(start))
+	for it.Next() {
+		addrHash := common.BytesToHash(it.Key)
+		if maxResults > 0 && len(dump.Accounts) == maxResults {
+			dump.Next = &addrHash
+			break
+		}
+
+		var account ethState.Account
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return nil, err
+		}
+
+		entry := DumpAccount{
+			Balance:  (*hexutil.Big)(account.Balance),
+			Nonce:    hexutil.Uint64(account.Nonce),
+			Root:     account.Root,
+			CodeHash: common.BytesToHash(account.CodeHash),
+			Storage:  make(map[common.Hash]DumpStorageEntry),
+		}
+		if preimage := accTrie.GetKey(it.Key); preimage != nil {
+			address := common.BytesToAddress(preimage)
+			entry.Address = &address
+		}
+		if !bytes.Equal(account.CodeHash, emptyCodeHash.Bytes()) {
+			if entry.Code, err = db.ContractCode(addrHash, entry.CodeHash); err != nil {
+				return nil, err
+			}
+		}
+
+		storageTrie, err := db.OpenStorageTrie(addrHash, account.Root)
+		if err != nil {
+			return nil, err
+		}
+		sit := trie.NewIterator(storageTrie.NodeIterator(nil))
+		for sit.Next() {
+			value, err := decodeStorage(sit.Value)
+			if err != nil {
+				return nil, err
+			}
+			slot := DumpStorageEntry{Value: value}
+			if preimage := storageTrie.GetKey(sit.Key); preimage != nil {
+				key := common.BytesToHash(preimage)
+				slot.Key = &key
+			}
+			entry.Storage[common.BytesToHash(sit.Key)] = slot
+		}
+		if sit.Err != nil {
+			return nil, sit.Err
+		}
+
+		dump.Accounts[addrHash] = entry
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+
+	return dump, nil
+}
+
+//StorageTrieAt returns the storage trie of an account, in the state obtained by
+//applying the transactions of a block which come before txIndex
+func (s *State) StorageTrieAt(blockIndex int64, txIndex int, address common.Address) (ethState.Trie, error) {
+	block, err := s.GetBlockById(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if txIndex < 0 {
+		return nil, fmt.Errorf("invalid transaction index %d", txIndex)
+	}
+	if txIndex > len(block.Transactions()) {
+		return nil, fmt.Errorf("block %d has only %d transactions", blockIndex, len(block.Transactions()))
+	}
+
+	parentRoot, err := s.GetBlockRoot(blockIndex - 1)
+	if err != nil {
+		return nil, fmt.Errorf("block %d has no parent state", blockIndex)
+	}
+	statedb, err := ethState.New(parentRoot, s.ethState.Database())
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := block.BlockHash()
+	if err != nil {
+		return nil, err
+	}
+	blockCtx := blockContext{
+		Hash:  common.BytesToHash(hash),
+		Index: blockIndex,
+		Time:  block.GetCreatedTime(),
+	}
+	gp := new(core.GasPool).AddGas(s.gasLimit)
+	var usedGas uint64
+
+	for i, txBytes := range block.Transactions()[:txIndex] {
+		var t ethTypes.Transaction
+		if err := rlp.DecodeBytes(txBytes, &t); err != nil {
+			continue
+		}
+		msg, err := s.asMessage(&t)
+		if err != nil {
+			continue
+		}
+		// Rejected transactions leave the state untouched, as in ProcessBlock
+		applyMessage(statedb, &s.chainConfig, s.vmConfig, gp, &usedGas, blockCtx, msg, t.Hash(), i)
+	}
+
+	storageTrie := statedb.StorageTrie(address)
+	if storageTrie == nil {
+		return nil, fmt.Errorf("account %x doesn't exist", address)
+	}
+	return storageTrie, nil
+}
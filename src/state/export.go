@@ -0,0 +1,106 @@
+package state
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+// exportedBlock is an entry of an exported chain: a protobuf encoded block, and
+// the state root obtained after processing it
+type exportedBlock struct {
+	Block []byte
+	Root  common.Hash
+}
+
+//ExportChain writes the blocks with indexes between first and last (included)
+//to w, as a stream of RLP encoded entries each containing a protobuf encoded
+//block and the state root recorded for it. Missing blocks are skipped.
+func (s *State) ExportChain(w io.Writer, first, last int64) (int, error) {
+	if last < 0 || last > s.blockIndex {
+		last = s.blockIndex
+	}
+
+	count := 0
+	for index := first; index <= last; index++ {
+		block, err := s.GetBlockById(index)
+		if err != nil {
+			continue
+		}
+		root, err := s.GetBlockRoot(index)
+		if err != nil {
+			return count, fmt.Errorf("block %d: no state root recorded", index)
+		}
+		data, err := block.ProtoMarshal()
+		if err != nil {
+			return count, err
+		}
+		if err := rlp.Encode(w, &exportedBlock{Block: data, Root: root}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"first":  first,
+		"last":   last,
+		"blocks": count,
+	}).Info("Exported chain")
+
+	return count, nil
+}
+
+//ImportChain reads a stream written by ExportChain, and re-executes every block
+//through ProcessBlock. A block is only committed if it follows the head and
+//results in the exported state root. Blocks which were already processed are
+//only checked against their recorded root.
+func (s *State) ImportChain(r io.Reader) (int, error) {
+	stream := rlp.NewStream(r, 0)
+
+	count := 0
+	for {
+		var entry exportedBlock
+		if err := stream.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("entry %d: failed to parse: %v", count, err)
+		}
+
+		block := new(poset.Block)
+		if err := block.ProtoUnmarshal(entry.Block); err != nil {
+			return count, fmt.Errorf("entry %d: failed to decode block: %v", count, err)
+		}
+
+		var root common.Hash
+		var err error
+		switch index := block.Index(); {
+		case index <= s.blockIndex:
+			if root, err = s.GetBlockRoot(index); err != nil {
+				return count, fmt.Errorf("block %d: no state root recorded", index)
+			}
+		case index == s.blockIndex+1:
+			if root, err = s.processBlock(*block, &entry.Root); err != nil {
+				return count, fmt.Errorf("block %d: %v", index, err)
+			}
+		default:
+			return count, fmt.Errorf("block %d does not follow the head %d", index, s.blockIndex)
+		}
+		if root != entry.Root {
+			return count, fmt.Errorf("block %d: state root %s does not match exported root %s",
+				block.Index(), root.Hex(), entry.Root.Hex())
+		}
+		count++
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"blocks": count,
+		"head":   s.blockIndex,
+	}).Info("Imported chain")
+
+	return count, nil
+}
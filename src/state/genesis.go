@@ -0,0 +1,366 @@
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+var (
+	// genesisHashKey holds the hash of the genesis block the database was
+	// initialised with
+	genesisHashKey = []byte("GenesisHash")
+	// genesisBlockKey holds the RLP encoded genesis block
+	genesisBlockKey = []byte("GenesisBlock")
+)
+
+// Genesis is the specification of the first state of a chain: its chain
+// configuration, the accounts allocated at inception, and the fields of the
+// genesis block. All the nodes of a network must start from the same Genesis.
+type Genesis struct {
+	Config    *params.ChainConfig `json:"config"`
+	Timestamp math.HexOrDecimal64 `json:"timestamp,omitempty"`
+	GasLimit  math.HexOrDecimal64 `json:"gasLimit"`
+	ExtraData hexutil.Bytes       `json:"extraData,omitempty"`
+	Alloc     GenesisAlloc        `json:"alloc"`
+}
+
+// GenesisAlloc maps addresses, with or without 0x prefix, to the accounts
+// allocated in the genesis state
+type GenesisAlloc map[string]GenesisAccount
+
+// GenesisAccount is an account of the genesis state. Balance is a decimal or
+// 0x prefixed hexadecimal number, Code and Storage are hex encoded.
+type GenesisAccount struct {
+	Balance string              `json:"balance"`
+	Nonce   math.HexOrDecimal64 `json:"nonce,omitempty"`
+	Code    string              `json:"code,omitempty"`
+	Storage map[string]string   `json:"storage,omitempty"`
+}
+
+// GenesisBlock is block 0 of a chain. Its hash covers the chain configuration
+// and the genesis state, and identifies the chain.
+type GenesisBlock struct {
+	ConfigHash common.Hash
+	Root       common.Hash
+	Timestamp  uint64
+	GasLimit   uint64
+	ExtraData  []byte
+}
+
+//Hash returns the keccak256 hash of the RLP encoding of the block
+func (b *GenesisBlock) Hash() common.Hash {
+	data, _ := rlp.EncodeToBytes(b)
+	return crypto.Keccak256Hash(data)
+}
+
+//posetBlock returns the genesis block in the form of the blocks processed by
+//the State, to be stored as block 0: it has no transactions, and the genesis
+//timestamp as creation time.
+func (b *GenesisBlock) posetBlock() *poset.Block {
+	block := poset.NewBlock(0, 0, nil, nil)
+	block.CreatedTime = int64(b.Timestamp)
+	return &block
+}
+
+//DefaultGenesis returns the genesis used when there is no genesis file: chain
+//ID 1 and no allocated accounts
+func DefaultGenesis() *Genesis {
+	g := &Genesis{}
+	g.setDefaults()
+	return g
+}
+
+//LoadGenesis reads a genesis file. It returns the default genesis if the file
+//does not exist.
+func LoadGenesis(genesisFile string) (*Genesis, error) {
+	if _, err := os.Stat(genesisFile); os.IsNotExist(err) {
+		return DefaultGenesis(), nil
+	}
+
+	contents, err := ioutil.ReadFile(genesisFile)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis := &Genesis{}
+	if err := json.Unmarshal(contents, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", genesisFile, err)
+	}
+	genesis.setDefaults()
+
+	return genesis, nil
+}
+
+//SaveGenesis writes a genesis file, creating its directory if needed
+func SaveGenesis(genesisFile string, genesis *Genesis) error {
+	data, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(genesisFile), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(genesisFile, append(data, '\n'), 0644)
+}
+
+//Validate checks the chain configuration, the genesis block fields and the
+//allocated accounts, and returns the problems found
+func (g *Genesis) Validate() []error {
+	var errs []error
+
+	if g.Config != nil && g.Config.ChainID != nil && g.Config.ChainID.Sign() <= 0 {
+		errs = append(errs, fmt.Errorf("chain ID must be positive, not %v", g.Config.ChainID))
+	}
+	if uint64(len(g.ExtraData)) > params.MaximumExtraDataSize {
+		errs = append(errs, fmt.Errorf("extra data is %d bytes long, the maximum is %d",
+			len(g.ExtraData), params.MaximumExtraDataSize))
+	}
+
+	addrs := make([]string, 0, len(g.Alloc))
+	for addr := range g.Alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	seen := make(map[common.Address]string)
+	for _, addr := range addrs {
+		account := g.Alloc[addr]
+		if !common.IsHexAddress(strings.TrimSpace(addr)) {
+			errs = append(errs, fmt.Errorf("account %q: invalid address", addr))
+			continue
+		}
+		address := common.HexToAddress(addr)
+		if other, ok := seen[address]; ok {
+			errs = append(errs, fmt.Errorf("account %s: allocated twice, as %q and %q", address.Hex(), other, addr))
+		}
+		seen[address] = addr
+
+		if balance, ok := math.ParseBig256(account.Balance); !ok || balance.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("account %s: invalid balance %q", addr, account.Balance))
+		}
+		if _, err := decodeHex(account.Code); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: invalid code: %v", addr, err))
+		}
+		for key, value := range account.Storage {
+			for _, word := range []string{key, value} {
+				if data, err := decodeHex(word); err != nil || len(data) > common.HashLength {
+					errs = append(errs, fmt.Errorf("account %s: invalid storage word %q", addr, word))
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+//decodeHex decodes a hex string, with or without 0x prefix and leading zero
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
+
+func (g *Genesis) setDefaults() {
+	if g.Config == nil {
+		g.Config = &params.ChainConfig{}
+	}
+	if g.Config.ChainID == nil {
+		g.Config.ChainID = new(big.Int).Set(defaultChainID)
+	}
+	if g.GasLimit == 0 {
+		g.GasLimit = math.HexOrDecimal64(defaultGasLimit)
+	}
+}
+
+//apply creates the allocated accounts in a StateDB
+func (g *Genesis) apply(statedb *ethState.StateDB) error {
+	for addr, account := range g.Alloc {
+		address := common.HexToAddress(addr)
+		balance, ok := math.ParseBig256(account.Balance)
+		if !ok {
+			return fmt.Errorf("account %s: invalid balance %q", addr, account.Balance)
+		}
+		statedb.SetBalance(address, balance)
+		statedb.SetNonce(address, uint64(account.Nonce))
+		statedb.SetCode(address, common.FromHex(account.Code))
+		for key, value := range account.Storage {
+			statedb.SetState(address, common.HexToHash(key), common.HexToHash(value))
+		}
+	}
+	return nil
+}
+
+//commit writes the genesis state to a state database, and returns the genesis
+//block
+func (g *Genesis) commit(db ethState.Database) (*GenesisBlock, error) {
+	statedb, err := ethState.New(common.Hash{}, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.apply(statedb); err != nil {
+		return nil, err
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(g.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GenesisBlock{
+		ConfigHash: crypto.Keccak256Hash(config),
+		Root:       root,
+		Timestamp:  uint64(g.Timestamp),
+		GasLimit:   uint64(g.GasLimit),
+		ExtraData:  g.ExtraData,
+	}, nil
+}
+
+//ToBlock computes the genesis block, without writing anything
+func (g *Genesis) ToBlock() (*GenesisBlock, error) {
+	return g.commit(ethState.NewDatabase(ethdb.NewMemDatabase()))
+}
+
+//InitGenesis sets up the State with a genesis. On an empty database, the
+//genesis state is written along with the genesis block, which is stored as
+//block 0, and its hash. Otherwise, the hash of the genesis must match the one
+//stored in the database, so that a node never runs a chain with a different
+//genesis than the one it was initialised with. Databases created before the
+//genesis hash was recorded must contain the genesis state, and must not have
+//a block 0 of their own. It returns the genesis hash.
+func (s *State) InitGenesis(genesis *Genesis) (common.Hash, error) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	block, err := genesis.ToBlock()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hash := block.Hash()
+
+	stored, _ := s.db.Get(genesisHashKey)
+	switch {
+	case len(stored) != 0:
+		if common.BytesToHash(stored) != hash {
+			return hash, fmt.Errorf("genesis mismatch: database was initialised with genesis %s, not %s",
+				common.BytesToHash(stored).Hex(), hash.Hex())
+		}
+	case s.blockIndex == 0 && (s.GetRoot() == (common.Hash{}) || s.GetRoot() == ethTypes.EmptyRootHash):
+		if _, err := genesis.commit(s.ethState.Database()); err != nil {
+			return hash, err
+		}
+		batch := s.db.NewBatch()
+		if err := writeGenesis(batch, block); err != nil {
+			return hash, err
+		}
+		if err := writeBlock(batch, block.posetBlock(), block.Root); err != nil {
+			return hash, err
+		}
+		if err := s.writeCommit(batch, 0, block.Root); err != nil {
+			return hash, err
+		}
+		if err := s.ethState.Reset(block.Root); err != nil {
+			return hash, err
+		}
+		s.logger.WithFields(logrus.Fields{
+			"hash":     hash.Hex(),
+			"root":     block.Root.Hex(),
+			"accounts": len(genesis.Alloc),
+		}).Info("Wrote genesis")
+	default:
+		if _, err := s.ethState.Database().OpenTrie(block.Root); err != nil {
+			return hash, fmt.Errorf("genesis mismatch: database does not contain the state %s of genesis %s: %v",
+				block.Root.Hex(), hash.Hex(), err)
+		}
+		if _, err := s.db.Get(blockKey(0)); err == nil {
+			return hash, fmt.Errorf("database has a block 0 which is not genesis %s, it must be resynced", hash.Hex())
+		}
+		batch := s.db.NewBatch()
+		if err := writeGenesis(batch, block); err != nil {
+			return hash, err
+		}
+		if err := writeBlock(batch, block.posetBlock(), block.Root); err != nil {
+			return hash, err
+		}
+		if err := batch.Write(); err != nil {
+			return hash, err
+		}
+		s.logger.WithFields(logrus.Fields{
+			"hash": hash.Hex(),
+			"root": block.Root.Hex(),
+		}).Info("Recorded genesis of an existing database")
+	}
+
+	s.genesis = hash
+	s.chainConfig = *genesis.Config
+	s.signer = ethTypes.NewEIP155Signer(genesis.Config.ChainID)
+	s.gasLimit = uint64(genesis.GasLimit)
+
+	s.resetWAS()
+	s.txPool = NewTxPool(s.ethState.Copy(), s.signer, s.chainConfig, s.vmConfig, s.gasLimit, s.logger)
+
+	return hash, nil
+}
+
+//GenesisHash returns the hash of the genesis block, once InitGenesis was called
+func (s *State) GenesisHash() common.Hash {
+	return s.genesis
+}
+
+//GetGenesisBlock returns the genesis block stored in the database
+func (s *State) GetGenesisBlock() (*GenesisBlock, error) {
+	data, err := s.db.Get(genesisBlockKey)
+	if err != nil {
+		return nil, err
+	}
+	block := new(GenesisBlock)
+	if err := rlp.DecodeBytes(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+//ChainConfig returns the chain configuration of the genesis
+func (s *State) ChainConfig() *params.ChainConfig {
+	config := s.chainConfig
+	return &config
+}
+
+func writeGenesis(batch ethdb.Putter, block *GenesisBlock) error {
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(genesisBlockKey, data); err != nil {
+		return err
+	}
+	return batch.Put(genesisHashKey, block.Hash().Bytes())
+}
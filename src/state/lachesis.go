@@ -0,0 +1,31 @@
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+//ProcessLachesisBlock processes a block committed by Lachesis. Lachesis numbers
+//its blocks from 0, which is the index of the genesis block in the State, so
+//they are processed with their index shifted by one. Lachesis sets the
+//creation time of blocks from the local clock of each node, which differs
+//between nodes, and its events carry no agreed time. The time of the block is
+//therefore derived from the round in which it was received, which all the
+//nodes agree on: it is the time of the genesis block plus one second per
+//round, so that it grows with the chain on every node.
+func (s *State) ProcessLachesisBlock(block poset.Block) (common.Hash, error) {
+	//Lachesis keeps a reference to the block body
+	body := *block.Body
+	body.Index++
+	block.Body = &body
+	block.CreatedTime = s.blockTime(0) + block.RoundReceived()
+
+	return s.ProcessBlock(block)
+}
+
+//GetLachesisSnapshot returns a snapshot of the state after the Lachesis block
+//with the given index, that is the block with the next index in the State
+func (s *State) GetLachesisSnapshot(blockIndex int64) ([]byte, error) {
+	return s.GetSnapshot(blockIndex + 1)
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+)
+
+// OverrideAccount specifies the fields of an account to replace before
+// executing a call. State replaces the whole storage of the account, whereas
+// StateDiff only replaces the given slots; they cannot be used together.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the set of accounts to override before executing a call
+type StateOverride map[common.Address]OverrideAccount
+
+//Apply overrides the accounts of a StateDB. It should only ever be applied to a
+//copy of the state which is thrown away afterwards.
+func (o StateOverride) Apply(statedb *ethState.StateDB) error {
+	for addr, account := range o {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+
+		if account.State != nil {
+			// Recreating the account drops its storage and keeps its balance
+			nonce := statedb.GetNonce(addr)
+			code := statedb.GetCode(addr)
+			statedb.CreateAccount(addr)
+			statedb.SetNonce(addr, nonce)
+			statedb.SetCode(addr, code)
+			for key, value := range *account.State {
+				statedb.SetState(addr, key, value)
+			}
+		}
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				statedb.SetState(addr, key, value)
+			}
+		}
+
+		if account.Nonce != nil {
+			statedb.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			statedb.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			statedb.SetBalance(addr, account.Balance.ToInt())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// AccountResult is the EIP-1186 proof of an account and some of its storage
+// slots, against the state root of a block
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the EIP-1186 proof of a storage slot, against the storage
+// root of its account
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// proofList collects the trie nodes of a proof, from the root to the leaf
+type proofList []string
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, hexutil.Encode(value))
+	return nil
+}
+
+//GetProof returns the proof of an account and of the given storage slots,
+//against the state root of the block with the given index, or of the last
+//commit if blockIndex is negative.
+func (s *State) GetProof(address common.Address, storageKeys []common.Hash, blockIndex int64) (*AccountResult, error) {
+	root, err := s.rootAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	triedb := s.ethState.Database().TrieDB()
+
+	accTrie, err := trie.NewSecure(root, triedb, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var accountProof proofList
+	if err := accTrie.Prove(crypto.Keccak256(address.Bytes()), 0, &accountProof); err != nil {
+		return nil, err
+	}
+
+	account := ethState.Account{
+		Balance:  new(big.Int),
+		Root:     emptyRoot,
+		CodeHash: emptyCodeHash.Bytes(),
+	}
+	enc, err := accTrie.TryGet(address.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return nil, err
+		}
+	}
+
+	storageTrie, err := trie.NewSecure(account.Root, triedb, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		var proof proofList
+		if err := storageTrie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof); err != nil {
+			return nil, err
+		}
+		value, err := storageTrie.TryGet(key.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		v, err := decodeStorage(value)
+		if err != nil {
+			return nil, err
+		}
+		storageProof[i] = StorageResult{
+			Key:   key.Hex(),
+			Value: (*hexutil.Big)(v.Big()),
+			Proof: proof,
+		}
+	}
+
+	return &AccountResult{
+		Address:      address,
+		AccountProof: accountProof,
+		Balance:      (*hexutil.Big)(account.Balance),
+		CodeHash:     common.BytesToHash(account.CodeHash),
+		Nonce:        hexutil.Uint64(account.Nonce),
+		StorageHash:  account.Root,
+		StorageProof: storageProof,
+	}, nil
+}
+
+// proofDB serves the nodes of a proof, keyed by their hashes, to
+// trie.VerifyProof
+type proofDB map[common.Hash][]byte
+
+func newProofDB(proof []string) (proofDB, error) {
+	db := make(proofDB)
+	for _, node := range proof {
+		data, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, err
+		}
+		db[crypto.Keccak256Hash(data)] = data
+	}
+	return db, nil
+}
+
+func (db proofDB) Get(key []byte) ([]byte, error) {
+	if data, ok := db[common.BytesToHash(key)]; ok {
+		return data, nil
+	}
+	return nil, errors.New("proof node not found")
+}
+
+func (db proofDB) Has(key []byte) (bool, error) {
+	_, ok := db[common.BytesToHash(key)]
+	return ok, nil
+}
+
+// verifyTrieProof checks a proof against the root of a secure trie, and
+// returns the value proven for the key, or nil if the proof shows that the key
+// is absent.
+func verifyTrieProof(root common.Hash, key []byte, proof []string) ([]byte, error) {
+	db, err := newProofDB(proof)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := trie.VerifyProof(root, crypto.Keccak256(key), db)
+	return value, err
+}
+
+// VerifyProof checks an account proof, and the proofs of its storage slots,
+// against a state root. It returns an error if any proof is invalid, or if it
+// doesn't prove the values contained in the result.
+func VerifyProof(root common.Hash, result *AccountResult) error {
+	enc, err := verifyTrieProof(root, result.Address.Bytes(), result.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+
+	account := ethState.Account{
+		Balance:  new(big.Int),
+		Root:     emptyRoot,
+		CodeHash: emptyCodeHash.Bytes(),
+	}
+	if enc != nil {
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return fmt.Errorf("invalid account: %v", err)
+		}
+	}
+
+	if result.Balance == nil || account.Balance.Cmp(result.Balance.ToInt()) != 0 {
+		return fmt.Errorf("balance %v is not the proven balance %v", result.Balance, account.Balance)
+	}
+	if account.Nonce != uint64(result.Nonce) {
+		return fmt.Errorf("nonce %d is not the proven nonce %d", result.Nonce, account.Nonce)
+	}
+	if account.Root != result.StorageHash {
+		return fmt.Errorf("storage hash %s is not the proven storage hash %s",
+			result.StorageHash.Hex(), account.Root.Hex())
+	}
+	if !bytes.Equal(account.CodeHash, result.CodeHash.Bytes()) {
+		return fmt.Errorf("code hash %s is not the proven code hash %x",
+			result.CodeHash.Hex(), account.CodeHash)
+	}
+
+	for _, storage := range result.StorageProof {
+		key := common.HexToHash(storage.Key)
+		value, err := verifyTrieProof(account.Root, key.Bytes(), storage.Proof)
+		if err != nil {
+			return fmt.Errorf("invalid proof of storage slot %s: %v", storage.Key, err)
+		}
+		v, err := decodeStorage(value)
+		if err != nil {
+			return fmt.Errorf("invalid storage slot %s: %v", storage.Key, err)
+		}
+		if storage.Value == nil || v.Big().Cmp(storage.Value.ToInt()) != 0 {
+			return fmt.Errorf("storage slot %s value %v is not the proven value %v",
+				storage.Key, storage.Value, v.Big())
+		}
+	}
+
+	return nil
+}
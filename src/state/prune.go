@@ -0,0 +1,254 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// blockRoot is the state root of a block whose trie is kept in memory in pruned
+// mode
+type blockRoot struct {
+	index int64
+	root  common.Hash
+}
+
+//EnablePruning switches the State to pruned mode. Instead of writing the state
+//of every block to disk, the tries of the last triesInMemory blocks are kept in
+//memory, and older ones are dereferenced so that their stale nodes are garbage
+//collected. Dirty nodes are written to disk when they exceed dirtyLimit
+//megabytes, and the state of the head block is flushed every flushInterval, so
+//that a crash only loses recent blocks, which InitState rewinds.
+func (s *State) EnablePruning(triesInMemory int, dirtyLimit int, flushInterval time.Duration) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	s.pruning = true
+	s.triesInMemory = int64(triesInMemory)
+	s.trieDirtyLimit = common.StorageSize(dirtyLimit) * 1024 * 1024
+	s.trieFlushInterval = flushInterval
+	s.lastTrieFlush = time.Now()
+
+	s.logger.WithFields(logrus.Fields{
+		"tries":          triesInMemory,
+		"dirty_limit":    s.trieDirtyLimit,
+		"flush_interval": flushInterval,
+	}).Info("Pruning enabled")
+}
+
+//pruneTries keeps the trie of a newly committed block in memory, and releases
+//the ones which fell out of the window of recent blocks. It is only used in
+//pruned mode, where block commits are not written to disk.
+func (s *State) pruneTries(blockIndex int64, root common.Hash) error {
+	triedb := s.ethState.Database().TrieDB()
+
+	triedb.Reference(root, common.Hash{})
+	s.triegc = append(s.triegc, blockRoot{index: blockIndex, root: root})
+
+	//write the oldest dirty nodes to disk if they exceed the allowance
+	if nodes, preimages := triedb.Size(); nodes > s.trieDirtyLimit || preimages > 4*1024*1024 {
+		if err := triedb.Cap(s.trieDirtyLimit - ethdb.IdealBatchSize); err != nil {
+			return err
+		}
+	}
+
+	//periodically flush the head state so that it survives a crash
+	if time.Since(s.lastTrieFlush) > s.trieFlushInterval {
+		if err := triedb.Commit(root, true); err != nil {
+			return err
+		}
+		s.lastTrieFlush = time.Now()
+		s.logger.WithFields(logrus.Fields{
+			"block": blockIndex,
+			"root":  root.Hex(),
+		}).Debug("Flushed state")
+	}
+
+	//dereference the tries of the blocks which are no longer recent
+	for len(s.triegc) > 0 && s.triegc[0].index <= blockIndex-s.triesInMemory {
+		triedb.Dereference(s.triegc[0].root)
+		s.triegc = s.triegc[1:]
+	}
+
+	return nil
+}
+
+//flushHead writes the trie of the head state to disk. It lets a pruned node
+//restart from its head.
+func (s *State) flushHead() error {
+	if !s.pruning {
+		return nil
+	}
+	return s.ethState.Database().TrieDB().Commit(s.GetRoot(), false)
+}
+
+//recoverHead rewinds the chain to the last block whose state is on disk. It is
+//used when the head state is missing, as happens when a pruned node stops
+//without flushing the tries it kept in memory. If no block state is left, all
+//blocks are deleted and the state starts again from the genesis.
+func (s *State) recoverHead(db ethState.Database) (common.Hash, error) {
+	head := s.blockIndex
+
+	index := head
+	root := common.Hash{}
+	for ; index >= 0; index-- {
+		blockRoot, err := s.GetBlockRoot(index)
+		if err != nil {
+			continue
+		}
+		if _, err := db.OpenTrie(blockRoot); err == nil {
+			root = blockRoot
+			break
+		}
+	}
+
+	batch := s.db.NewBatch()
+	for i := head; i > index; i-- {
+		if err := s.deleteBlock(batch, i); err != nil {
+			return root, err
+		}
+	}
+
+	//fall back to the genesis state, which is always written to disk
+	if index < 0 {
+		if genesis, err := s.GetGenesisBlock(); err == nil {
+			if _, err := db.OpenTrie(genesis.Root); err == nil {
+				index, root = 0, genesis.Root
+			}
+		}
+	}
+
+	if index < 0 {
+		index = 0
+		for _, key := range [][]byte{rootKey, headBlockKey, lastCommitKey} {
+			if err := batch.Delete(key); err != nil {
+				return root, err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return root, err
+		}
+	} else if err := s.writeCommit(batch, index, root); err != nil {
+		return root, err
+	}
+	s.blockIndex = index
+
+	s.logger.WithFields(logrus.Fields{
+		"from": head,
+		"to":   index,
+		"root": root.Hex(),
+	}).Warn("Head state missing, rewound to the last block with a state")
+
+	return root, nil
+}
+
+//Prune deletes from the database all the trie nodes and contract codes which
+//are not part of the head or genesis states, and compacts the database. States of older
+//blocks are no longer available afterwards. It returns the number of deleted
+//entries. It must only be used on a stopped node.
+func (s *State) Prune() (int, error) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	ldb, ok := s.db.(interface {
+		LDB() *leveldb.DB
+		NewIterator() iterator.Iterator
+	})
+	if !ok {
+		return 0, fmt.Errorf("pruning requires a LevelDB database")
+	}
+
+	if err := s.flushHead(); err != nil {
+		return 0, err
+	}
+
+	//mark the nodes and codes of the head state, and of the genesis state
+	//which recoverHead falls back to
+	roots := []common.Hash{s.GetRoot()}
+	if genesis, err := s.GetGenesisBlock(); err == nil {
+		roots = append(roots, genesis.Root)
+	}
+	keep := make(map[common.Hash]struct{})
+	for _, root := range roots {
+		statedb, err := ethState.New(root, ethState.NewDatabase(s.db))
+		if err != nil {
+			return 0, err
+		}
+		it := ethState.NewNodeIterator(statedb)
+		for it.Next() {
+			if it.Hash != (common.Hash{}) {
+				keep[it.Hash] = struct{}{}
+			}
+		}
+		if it.Error != nil {
+			return 0, it.Error
+		}
+	}
+
+	//transactions and blocks are also stored under the hash of their encoding
+	for index := int64(0); index <= s.blockIndex; index++ {
+		block, err := s.GetBlockById(index)
+		if err != nil {
+			continue
+		}
+		if hash, err := block.BlockHash(); err == nil {
+			keep[common.BytesToHash(hash)] = struct{}{}
+		}
+		for _, txBytes := range block.Transactions() {
+			keep[crypto.Keccak256Hash(txBytes)] = struct{}{}
+		}
+	}
+
+	//sweep the content addressed entries which were not marked
+	deleted := 0
+	batch := s.db.NewBatch()
+	dbIt := ldb.NewIterator()
+	for dbIt.Next() {
+		key := dbIt.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key)
+		if _, ok := keep[hash]; ok || crypto.Keccak256Hash(dbIt.Value()) != hash {
+			continue
+		}
+		if err := batch.Delete(common.CopyBytes(key)); err != nil {
+			dbIt.Release()
+			return deleted, err
+		}
+		deleted++
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				dbIt.Release()
+				return deleted, err
+			}
+			batch.Reset()
+		}
+	}
+	dbIt.Release()
+	if err := dbIt.Error(); err != nil {
+		return deleted, err
+	}
+	if err := batch.Write(); err != nil {
+		return deleted, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"kept":    len(keep),
+		"deleted": deleted,
+	}).Info("Pruned state")
+
+	if err := ldb.LDB().CompactRange(util.Range{}); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
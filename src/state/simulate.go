@@ -0,0 +1,145 @@
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sirupsen/logrus"
+)
+
+// Simulation is the outcome of executing a list of messages on top of a block,
+// without committing anything
+type Simulation struct {
+	BlockIndex   int64         `json:"blockIndex"`
+	Transactions []SimulatedTx `json:"transactions"`
+	StateDiff    StateDiff     `json:"stateDiff"`
+}
+
+// SimulatedTx is the outcome of a simulated message. The receipt carries the
+// status, gas used and logs. Error is set if the message could not be applied
+// at all.
+type SimulatedTx struct {
+	Receipt    *ethTypes.Receipt `json:"receipt"`
+	ReturnData hexutil.Bytes     `json:"returnData"`
+	Error      string            `json:"error,omitempty"`
+}
+
+//Simulate applies messages in order, as the transactions of a block following
+//the given one, or the last one if blockIndex is negative. Messages are applied
+//the same way as the transactions of a real block, but on a copy of the state,
+//so that nothing is persisted. The simulated block has the time of the given
+//block. Nonces are not checked; messages are given the current nonces of their
+//senders.
+func (s *State) Simulate(msgs []ethTypes.Message, blockIndex int64) (*Simulation, error) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	statedb, err := s.stateAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if blockIndex < 0 {
+		blockIndex = s.blockIndex
+	}
+	baseRoot := statedb.IntermediateRoot(true)
+
+	block := blockContext{
+		Index: blockIndex + 1,
+		Time:  s.blockTime(blockIndex),
+	}
+	gp := new(core.GasPool).AddGas(s.gasLimit)
+	var usedGas uint64
+
+	res := &Simulation{
+		BlockIndex:   blockIndex,
+		Transactions: make([]SimulatedTx, 0, len(msgs)),
+	}
+	for i, m := range msgs {
+		msg := ethTypes.NewMessage(m.From(),
+			m.To(),
+			statedb.GetNonce(m.From()),
+			m.Value(),
+			m.Gas(),
+			m.GasPrice(),
+			m.Data(),
+			false)
+		txHash := simulatedTxHash(msg)
+
+		receipt, ret, err := applyMessage(statedb,
+			&s.chainConfig,
+			s.vmConfig,
+			gp,
+			&usedGas,
+			block,
+			msg,
+			txHash,
+			i)
+
+		tx := SimulatedTx{Receipt: receipt, ReturnData: ret}
+		if err != nil {
+			tx.Receipt = newFailedReceipt(statedb, usedGas, txHash)
+			tx.Error = err.Error()
+		}
+		res.Transactions = append(res.Transactions, tx)
+	}
+
+	// The simulated state is written to the trie cache, so that it can be
+	// compared with the base state, and released right after. If nothing
+	// changed, it is the base state, which must be kept. Otherwise it is
+	// referenced for the time of the diff, so that releasing it never drops a
+	// state which is also the one of a live block.
+	root, err := statedb.Commit(true)
+	if err != nil {
+		return nil, err
+	}
+	if root != baseRoot {
+		triedb := statedb.Database().TrieDB()
+		triedb.Reference(root, common.Hash{})
+		defer triedb.Dereference(root)
+	}
+
+	if res.StateDiff, err = diffStates(statedb.Database(), baseRoot, root); err != nil {
+		s.logger.WithError(err).Error("Simulate: diffing states")
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block":    blockIndex,
+		"messages": len(msgs),
+		"accounts": len(res.StateDiff),
+	}).Debug("Simulate")
+
+	return res, nil
+}
+
+//stateAt returns a copy of the state after the given block, or of the WAS if
+//blockIndex is negative
+func (s *State) stateAt(blockIndex int64) (*ethState.StateDB, error) {
+	if blockIndex < 0 {
+		return s.was.ethState.Copy(), nil
+	}
+	root, err := s.GetBlockRoot(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return ethState.New(root, s.was.ethState.Database())
+}
+
+//simulatedTxHash identifies a simulated message, which has no signature, so that
+//its receipt and logs can refer to it
+func simulatedTxHash(msg ethTypes.Message) common.Hash {
+	data, _ := rlp.EncodeToBytes([]interface{}{
+		msg.From(),
+		msg.Nonce(),
+		msg.To(),
+		msg.Value(),
+		msg.Gas(),
+		msg.GasPrice(),
+		msg.Data(),
+	})
+	return crypto.Keccak256Hash(data)
+}
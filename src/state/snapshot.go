@@ -0,0 +1,395 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCodeHash is the known hash of the empty EVM bytecode.
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+
+	// restoredBlockKey holds the index of the last block restored from a
+	// snapshot. The blocks between the genesis and it were never processed.
+	restoredBlockKey = []byte("RestoredBlock")
+)
+
+// Snapshot is a self-contained copy of the state of the chain after a given
+// block. Accounts and storage slots are listed in the order of their hashed
+// keys, which is the iteration order of the underlying tries, so the encoding
+// of a Snapshot only depends on the state it represents. It also carries the
+// preimages of the hashed keys, that is the account addresses and slot keys.
+type Snapshot struct {
+	Genesis    common.Hash
+	BlockIndex uint64
+	Block      []byte // protobuf encoded poset.Block
+	Root       common.Hash
+	Accounts   []SnapshotAccount
+}
+
+// SnapshotAccount is an account entry of a Snapshot, keyed by the hash of the
+// account address.
+type SnapshotAccount struct {
+	Hash     common.Hash
+	Nonce    uint64
+	Balance  *big.Int
+	Code     []byte
+	Storage  []SnapshotStorage
+	Preimage []byte // account address
+}
+
+// SnapshotStorage is a storage slot, keyed by the hash of the slot key. Value
+// is the RLP encoded value, as stored in the storage trie.
+type SnapshotStorage struct {
+	Key      common.Hash
+	Value    []byte
+	Preimage []byte // slot key
+}
+
+// Marshal RLP encodes the Snapshot
+func (sn *Snapshot) Marshal() ([]byte, error) {
+	return rlp.EncodeToBytes(sn)
+}
+
+// Unmarshal decodes an RLP encoded Snapshot
+func (sn *Snapshot) Unmarshal(data []byte) error {
+	return rlp.DecodeBytes(data, sn)
+}
+
+//GetSnapshot produces a deterministic snapshot of the state after the block
+//with the given index.
+func (s *State) GetSnapshot(blockIndex int64) ([]byte, error) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	root, err := s.GetBlockRoot(blockIndex)
+	if err != nil {
+		s.logger.WithError(err).Error("GetSnapshot: missing block root")
+		return nil, err
+	}
+
+	block, err := s.GetBlockById(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	blockBytes, err := block.ProtoMarshal()
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.ethState.Database()
+
+	accTrie, err := db.OpenTrie(root)
+	if err != nil {
+		s.logger.WithError(err).Error("GetSnapshot: opening account trie")
+		return nil, err
+	}
+
+	snapshot := Snapshot{
+		Genesis:    s.genesis,
+		BlockIndex: uint64(blockIndex),
+		Block:      blockBytes,
+		Root:       root,
+	}
+
+	it := trie.NewIterator(accTrie.NodeIterator(nil))
+	for it.Next() {
+		var account ethState.Account
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return nil, err
+		}
+
+		addrHash := common.BytesToHash(it.Key)
+		entry := SnapshotAccount{
+			Hash:     addrHash,
+			Nonce:    account.Nonce,
+			Balance:  account.Balance,
+			Preimage: common.CopyBytes(accTrie.GetKey(it.Key)),
+		}
+
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCodeHash {
+			if entry.Code, err = db.ContractCode(addrHash, codeHash); err != nil {
+				return nil, err
+			}
+		}
+
+		if account.Root != emptyRoot {
+			storageTrie, err := db.OpenStorageTrie(addrHash, account.Root)
+			if err != nil {
+				return nil, err
+			}
+			sit := trie.NewIterator(storageTrie.NodeIterator(nil))
+			for sit.Next() {
+				entry.Storage = append(entry.Storage, SnapshotStorage{
+					Key:      common.BytesToHash(sit.Key),
+					Value:    common.CopyBytes(sit.Value),
+					Preimage: common.CopyBytes(storageTrie.GetKey(sit.Key)),
+				})
+			}
+			if sit.Err != nil {
+				return nil, sit.Err
+			}
+		}
+
+		snapshot.Accounts = append(snapshot.Accounts, entry)
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block":    blockIndex,
+		"root":     root.Hex(),
+		"accounts": len(snapshot.Accounts),
+	}).Debug("GetSnapshot")
+
+	return snapshot.Marshal()
+}
+
+//Restore rebuilds the state from a snapshot produced by GetSnapshot. The snapshot
+//must be taken on a chain with the same genesis. Its root must match the one
+//recorded locally for the same block or, on a node which doesn't have the
+//block, a root trusted with TrustBlockRoot; and the root of the rebuilt state
+//must match it. On success, the State is reset to the restored block and root,
+//and the blocks above it are deleted.
+func (s *State) Restore(data []byte) (common.Hash, error) {
+	var snapshot Snapshot
+	if err := snapshot.Unmarshal(data); err != nil {
+		s.logger.WithError(err).Error("Restore: decoding snapshot")
+		return common.Hash{}, err
+	}
+
+	if snapshot.Genesis != s.genesis {
+		return common.Hash{}, fmt.Errorf("snapshot of genesis %s, this node has genesis %s",
+			snapshot.Genesis.Hex(), s.genesis.Hex())
+	}
+
+	block := new(poset.Block)
+	if err := block.ProtoUnmarshal(snapshot.Block); err != nil {
+		s.logger.WithError(err).Error("Restore: decoding block")
+		return common.Hash{}, err
+	}
+	blockIndex := int64(snapshot.BlockIndex)
+	if block.Index() != blockIndex {
+		return common.Hash{}, fmt.Errorf("snapshot block index %d does not match block %d",
+			blockIndex, block.Index())
+	}
+
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	expected, err := s.GetBlockRoot(blockIndex)
+	if err != nil {
+		var ok bool
+		if expected, ok = s.trustedRoots[blockIndex]; !ok {
+			return common.Hash{}, fmt.Errorf("no recorded or trusted state root for block %d", blockIndex)
+		}
+	}
+	if snapshot.Root != expected {
+		return common.Hash{}, fmt.Errorf("snapshot root %s does not match root %s expected for block %d",
+			snapshot.Root.Hex(), expected.Hex(), blockIndex)
+	}
+
+	triedb := s.ethState.Database().TrieDB()
+	batch := s.db.NewBatch()
+
+	accTrie, err := trie.New(common.Hash{}, triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	for _, entry := range snapshot.Accounts {
+		storageRoot := emptyRoot
+		if len(entry.Storage) > 0 {
+			storageTrie, err := trie.New(common.Hash{}, triedb)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			for _, slot := range entry.Storage {
+				if err := storageTrie.TryUpdate(slot.Key[:], slot.Value); err != nil {
+					return common.Hash{}, err
+				}
+				if err := writeSecureKey(batch, slot.Key, slot.Preimage); err != nil {
+					return common.Hash{}, err
+				}
+			}
+			if storageRoot, err = storageTrie.Commit(nil); err != nil {
+				return common.Hash{}, err
+			}
+		}
+
+		codeHash := emptyCodeHash
+		if len(entry.Code) > 0 {
+			codeHash = crypto.Keccak256Hash(entry.Code)
+			triedb.InsertBlob(codeHash, entry.Code)
+		}
+
+		balance := entry.Balance
+		if balance == nil {
+			balance = new(big.Int)
+		}
+
+		enc, err := rlp.EncodeToBytes(&ethState.Account{
+			Nonce:    entry.Nonce,
+			Balance:  balance,
+			Root:     storageRoot,
+			CodeHash: codeHash.Bytes(),
+		})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if err := accTrie.TryUpdate(entry.Hash[:], enc); err != nil {
+			return common.Hash{}, err
+		}
+		if err := writeSecureKey(batch, entry.Hash, entry.Preimage); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	// Reference the storage tries and code from the account trie, as the
+	// StateDB does, so that they are flushed along with it.
+	root, err := accTrie.Commit(func(leaf []byte, parent common.Hash) error {
+		var account ethState.Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		if account.Root != emptyRoot {
+			triedb.Reference(account.Root, parent)
+		}
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCodeHash {
+			triedb.Reference(codeHash, parent)
+		}
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if root != snapshot.Root {
+		return common.Hash{}, fmt.Errorf("restored state root %s does not match snapshot root %s",
+			root.Hex(), snapshot.Root.Hex())
+	}
+
+	if err := triedb.Commit(root, false); err != nil {
+		s.logger.WithError(err).Error("Restore: writing tries")
+		return common.Hash{}, err
+	}
+
+	//blocks above the restored one no longer follow from the state
+	for index := s.blockIndex; index > blockIndex; index-- {
+		if err := s.deleteBlock(batch, index); err != nil {
+			s.logger.WithError(err).WithField("block", index).Error("Restore: deleting block")
+			return common.Hash{}, err
+		}
+	}
+	if err := writeBlock(batch, block, root); err != nil {
+		return common.Hash{}, err
+	}
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(blockIndex))
+	if err := batch.Put(restoredBlockKey, index); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.writeCommit(batch, blockIndex, root); err != nil {
+		return common.Hash{}, err
+	}
+
+	if err := s.reset(blockIndex, root); err != nil {
+		return common.Hash{}, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block": blockIndex,
+		"root":  root.Hex(),
+	}).Info("Restored state from snapshot")
+
+	return root, nil
+}
+
+//TrustBlockRoot records the state root of a block, which a snapshot of the block
+//must match to be restored on a node which doesn't have it. It is meant to be
+//obtained from a trusted source, such as the operator of another node.
+func (s *State) TrustBlockRoot(blockIndex int64, root common.Hash) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	s.trustedRoots[blockIndex] = root
+}
+
+//restoredBlock returns the index of the last block restored from a snapshot.
+//ok is false if the State was never restored.
+func (s *State) restoredBlock() (blockIndex int64, ok bool) {
+	data, err := s.db.Get(restoredBlockKey)
+	if err != nil || len(data) != 8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(data)), true
+}
+
+//writeSecureKey adds to a batch the preimage of a hashed trie key, after
+//checking it. Snapshots taken from a state without preimages have none.
+func writeSecureKey(batch ethdb.Putter, hash common.Hash, preimage []byte) error {
+	if len(preimage) == 0 {
+		return nil
+	}
+	if crypto.Keccak256Hash(preimage) != hash {
+		return fmt.Errorf("invalid preimage %x of trie key %s", preimage, hash.Hex())
+	}
+	return batch.Put(preimageKey(hash), preimage)
+}
+
+//writeBlock adds to a batch a block along with the state root obtained after
+//processing it
+func writeBlock(batch ethdb.Putter, block *poset.Block, root common.Hash) error {
+	hash, err := block.BlockHash()
+	if err != nil {
+		return err
+	}
+	data, err := block.ProtoMarshal()
+	if err != nil {
+		return err
+	}
+
+	if err := batch.Put(hash, data); err != nil {
+		return err
+	}
+	if err := batch.Put(blockKey(block.Index()), data); err != nil {
+		return err
+	}
+	return batch.Put(blockRootKey(block.Index()), root.Bytes())
+}
+
+//reset points the main StateDB, the WAS, and the TxPool, to the given root, and
+//sets the head block index.
+func (s *State) reset(blockIndex int64, root common.Hash) error {
+	if err := s.ethState.Reset(root); err != nil {
+		s.logger.WithError(err).Error("Resetting main StateDB")
+		return err
+	}
+	if err := s.was.Reset(root); err != nil {
+		s.logger.WithError(err).Error("Resetting WAS")
+		return err
+	}
+	if err := s.txPool.Reset(root); err != nil {
+		s.logger.WithError(err).Error("Resetting TxPool")
+		return err
+	}
+
+	s.blockIndex = blockIndex
+
+	return nil
+}
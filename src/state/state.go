@@ -2,38 +2,46 @@ package state
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
 	ethState "github.com/ethereum/go-ethereum/core/state"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/sirupsen/logrus"
 
-	bcommon "github.com/Fantom-foundation/go-evm/src/common"
 	"github.com/Fantom-foundation/go-lachesis/src/poset"
 )
 
 var (
-	chainID        = big.NewInt(1)
-	gasLimit       = big.NewInt(1000000000000000000)
+	// defaultChainID and defaultGasLimit apply until InitGenesis sets those of
+	// the genesis
+	defaultChainID  = big.NewInt(1)
+	defaultGasLimit = uint64(1000000000000000000)
+)
+
+var (
 	txMetaSuffix   = []byte{0x01}
 	receiptsPrefix = []byte("receipts-")
 	errorPrefix    = []byte("errors-")
 	MIPMapLevels   = []uint64{1000000, 500000, 100000, 50000, 1000}
 	headTxKey      = []byte("LastTx")
+	headBlockKey   = []byte("LastBlock")
 	rootKey        = []byte("root")
+	// lastCommitKey marks the last block, and root, which were fully committed
+	lastCommitKey = []byte("LastCommit")
+	// preimagePrefix is the prefix under which the trie database stores the
+	// preimages of hashed trie keys
+	preimagePrefix = []byte("secure-key-")
 )
 
 var (
@@ -49,6 +57,18 @@ func blockKey(index int64) []byte {
 	return []byte(fmt.Sprintf("%s_%09d", blockPrefix, index))
 }
 
+func blockRootKey(index int64) []byte {
+	return []byte(fmt.Sprintf("%s_%09d_%s", blockPrefix, index, rootSuffix))
+}
+
+func preimageKey(hash common.Hash) []byte {
+	return append(append([]byte{}, preimagePrefix...), hash.Bytes()...)
+}
+
+func blockDiffKey(index int64) []byte {
+	return []byte(fmt.Sprintf("%s_%09d_diff", blockPrefix, index))
+}
+
 type State struct {
 	db          ethdb.Database
 	commitMutex sync.Mutex
@@ -60,28 +80,50 @@ type State struct {
 	signer      ethTypes.Signer
 	chainConfig params.ChainConfig //vm.env is still tightly coupled with chainConfig
 	vmConfig    vm.Config
+	gasLimit    uint64
 
-	logger *logrus.Logger
-}
+	//hash of the genesis block, set by InitGenesis
+	genesis common.Hash
 
-func NewState(logger *logrus.Logger, dbFile string, dbCache int) (*State, error) {
+	//state roots of blocks which snapshots can be restored from, set by
+	//TrustBlockRoot
+	trustedRoots map[int64]common.Hash
 
-	handles, err := getFdLimit()
-	if err != nil {
-		return nil, err
-	}
+	//record the state diff of every block
+	stateDiffs bool
 
-	db, err := ethdb.NewLDBDatabase(dbFile, dbCache, handles)
-	if err != nil {
-		return nil, err
-	}
+	//pruned mode: tries of recent blocks are kept in memory instead of being
+	//written to disk
+	pruning           bool
+	triesInMemory     int64
+	trieDirtyLimit    common.StorageSize
+	trieFlushInterval time.Duration
+	lastTrieFlush     time.Time
+	triegc            []blockRoot
+
+	devMutex     sync.RWMutex
+	devMode      bool
+	impersonated map[common.Address]bool
+
+	logger *logrus.Logger
+}
+
+//NewState creates a State on top of a database, which can be opened with
+//NewDatabase
+func NewState(logger *logrus.Logger, db ethdb.Database, stateDiffs bool, preimages bool) (*State, error) {
 
 	s := &State{
 		db:          db,
-		signer:      ethTypes.NewEIP155Signer(chainID),
-		chainConfig: params.ChainConfig{ChainID: chainID},
-		vmConfig:    vm.Config{Tracer: vm.NewStructLogger(nil)},
-		logger:      logger,
+		signer:      ethTypes.NewEIP155Signer(defaultChainID),
+		chainConfig: params.ChainConfig{ChainID: defaultChainID},
+		gasLimit:    defaultGasLimit,
+		vmConfig: vm.Config{
+			Tracer:                  vm.NewStructLogger(nil),
+			EnablePreimageRecording: preimages,
+		},
+		stateDiffs:   stateDiffs,
+		trustedRoots: make(map[int64]common.Hash),
+		logger:       logger,
 	}
 
 	if err := s.InitState(); err != nil {
@@ -93,47 +135,47 @@ func NewState(logger *logrus.Logger, dbFile string, dbCache int) (*State, error)
 	return s, nil
 }
 
-// getFdLimit retrieves the number of file descriptors allowed to be opened by this
-// process.
-func getFdLimit() (int, error) {
-	var limit syscall.Rlimit
-	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
-		return 0, err
-	}
-	return int(limit.Cur), nil
-}
-
 //------------------------------------------------------------------------------
 
-func (s *State) Call(callMsg ethTypes.Message) ([]byte, error) {
+//Call executes a message on the state after the given block, or on a copy of
+//the WAS if blockIndex is negative, with the given accounts overridden, and
+//returns the data returned by the EVM. The EVM is given the number and time of
+//the block, or of the last one. Nothing is persisted.
+func (s *State) Call(callMsg ethTypes.Message, overrides StateOverride, blockIndex int64) ([]byte, error) {
 	s.logger.Debug("Call")
 	s.commitMutex.Lock()
 	defer s.commitMutex.Unlock()
 
-	context := vm.Context{
-		CanTransfer: core.CanTransfer,
-		Transfer:    core.Transfer,
-		GetHash:     func(uint64) common.Hash { return common.Hash{} },
-		// Message information
-		Origin:      callMsg.From(),
-		GasLimit:    callMsg.Gas(),
-		GasPrice:    callMsg.GasPrice(),
-		BlockNumber: big.NewInt(0), //the vm has a dependency on this..
+	// Call is done on a copy of the state...we don't want any changes to be persisted
+	// Call is a readonly operation
+	statedb, err := s.stateAt(blockIndex)
+	if err != nil {
+		s.logger.WithError(err).Error("Call: missing block state")
+		return nil, err
+	}
+	if blockIndex < 0 {
+		blockIndex = s.blockIndex
+	}
+	if err := overrides.Apply(statedb); err != nil {
+		return nil, err
 	}
 
+	context := newVMContext(callMsg, blockContext{
+		Index: blockIndex,
+		Time:  s.blockTime(blockIndex),
+	})
+
 	s.logger.WithField("From", callMsg.From().Hex()).Debug("Call(callMsg ethTypes.Message)")
 	s.logger.WithField("To", callMsg.To().Hex()).Debug("Call(callMsg ethTypes.Message)")
 	s.logger.WithField("Data", hexutil.Encode(callMsg.Data())).Debug("Call(callMsg ethTypes.Message)")
 
 	// The EVM should never be reused and is not thread safe.
-	// Call is done on a copy of the state...we don't want any changes to be persisted
-	// Call is a readonly operation
-	vmenv := vm.NewEVM(context, s.was.ethState.Copy(), &s.chainConfig, s.vmConfig)
+	vmenv := vm.NewEVM(context, statedb, &s.chainConfig, s.vmConfig)
 
 	// Apply the transaction to the current state (included in the env)
-	res, gas, failed, err := core.ApplyMessage(vmenv, callMsg, new(core.GasPool).AddGas(gasLimit.Uint64()))
+	res, gas, failed, err := core.ApplyMessage(vmenv, callMsg, new(core.GasPool).AddGas(s.gasLimit))
 	if err != nil {
-		s.logger.WithError(err).Error("Executing Call on WAS")
+		s.logger.WithError(err).Error("Executing Call")
 		return nil, err
 	}
 	s.logger.WithField("Failed", failed).Debug("Call(callMsg ethTypes.Message)")
@@ -148,41 +190,232 @@ func (s *State) GetBlockIndex() int64 {
 }
 
 func (s *State) ProcessBlock(block poset.Block) (common.Hash, error) {
+	return s.processBlock(block, nil)
+}
+
+//processBlock executes and commits a block. If expectedRoot is not nil, the
+//block is only committed if it results in that state root.
+func (s *State) processBlock(block poset.Block, expectedRoot *common.Hash) (common.Hash, error) {
 	s.logger.Debug("Process Block")
 	s.commitMutex.Lock()
 	defer s.commitMutex.Unlock()
 
 	blockIndex := block.Index()
-	hash, _ := block.BlockHash()
-	blockHash := common.BytesToHash(hash)
 
-	if block.GetCreatedTime() == 0 {
-		block.CreatedTime = time.Now().Unix()
+	//When Lachesis is bootstrapped from a persistent store, it replays blocks
+	//which may have already been committed. Return their recorded root instead
+	//of applying them a second time.
+	if root, err := s.GetBlockRoot(blockIndex); err == nil {
+		s.logger.WithField("blockIndex", blockIndex).Debug("Block already processed")
+		return root, nil
 	}
 
+	//The block time is executed by the EVM, so it must be the same on every
+	//node: it is taken from the consensus data, never from the local clock.
+	//Blocks without one take the time of their parent, and blocks never go
+	//back in time. The hash covers the time, so it is computed afterwards.
+	if parentTime := s.blockTime(s.blockIndex); block.GetCreatedTime() < parentTime {
+		block.CreatedTime = parentTime
+	}
+
+	hash, _ := block.BlockHash()
+	blockHash := common.BytesToHash(hash)
+
 	blockMarshal, _ := block.ProtoMarshal()
 
 	s.logger.WithField("block.GetCreatedTime", block.GetCreatedTime()).Debug("ProcessBlock(block poset.Block)")
 	s.logger.WithField("blockIndex", blockIndex).Debug("ProcessBlock(block poset.Block)")
 	s.logger.WithField("blockHash", block.BlockHex()).Debug("ProcessBlock(block poset.Block)")
 
+	//on failure, the head and the WAS are rolled back to the parent block
+	parentIndex := s.blockIndex
+	committed := false
+	defer func() {
+		if !committed {
+			s.blockIndex = parentIndex
+			s.resetWAS()
+		}
+	}()
+
 	s.blockIndex = blockIndex
+	parentRoot := s.GetRoot()
+
+	//everything but the tries is written in a single batch, after the block
+	//is executed, so that a crash can't leave a partially committed block
+	batch := s.db.NewBatch()
 
-	if err := s.db.Put(hash, blockMarshal); err != nil {
+	if err := batch.Put(hash, blockMarshal); err != nil {
 		return common.Hash{}, err
 	}
-	if err := s.db.Put(blockKey(blockIndex), blockMarshal); err != nil {
+	if err := batch.Put(blockKey(blockIndex), blockMarshal); err != nil {
 		return common.Hash{}, err
 	}
 
 	for txIndex, txBytes := range block.Transactions() {
-		// Block is valid, don't exit just because of transactions
-		if err := s.applyTransaction(txBytes, txIndex, blockHash); err != nil {
-			s.logger.WithError(err).Error("s.applyTransaction(txBytes, txIndex, blockHash);")
+		// Block is valid, don't exit just because of transactions. Rejected
+		// transactions get a failed receipt.
+		if err := s.applyTransaction(txBytes, txIndex, blockHash, blockIndex, block.GetCreatedTime()); err != nil {
+			s.logger.WithError(err).Warn("Transaction rejected")
+		}
+	}
+
+	root, err := s.was.Commit(batch, !s.pruning)
+	if err != nil {
+		s.logger.WithError(err).Error("Committing WAS")
+		return root, err
+	}
+
+	if expectedRoot != nil && root != *expectedRoot {
+		return root, fmt.Errorf("state root %s does not match expected root %s",
+			root.Hex(), expectedRoot.Hex())
+	}
+
+	if s.pruning {
+		if err := s.pruneTries(blockIndex, root); err != nil {
+			s.logger.WithError(err).Error("Pruning tries")
+			return root, err
 		}
 	}
 
-	return s.Commit()
+	if err := batch.Put(blockRootKey(blockIndex), root.Bytes()); err != nil {
+		return root, err
+	}
+
+	if s.stateDiffs {
+		if err := s.writeStateDiff(batch, blockIndex, parentRoot, root); err != nil {
+			s.logger.WithError(err).Error("Writing state diff")
+		}
+	}
+
+	if err := s.writeCommit(batch, blockIndex, root); err != nil {
+		s.logger.WithError(err).Error("Writing block")
+		return root, err
+	}
+	committed = true
+
+	if err := s.reset(blockIndex, root); err != nil {
+		return root, err
+	}
+	s.logger.WithField("root", root.Hex()).Debug("Committed")
+
+	return root, nil
+}
+
+//blockTime returns the creation time of a stored block, or 0 if it is unknown
+func (s *State) blockTime(blockIndex int64) int64 {
+	data, err := s.db.Get(blockKey(blockIndex))
+	if err != nil {
+		return 0
+	}
+	block := new(poset.Block)
+	if err := block.ProtoUnmarshal(data); err != nil {
+		return 0
+	}
+	return block.GetCreatedTime()
+}
+
+//GetBlockRoot returns the state root recorded after processing the block with
+//the given index
+func (s *State) GetBlockRoot(blockIndex int64) (common.Hash, error) {
+	data, err := s.db.Get(blockRootKey(blockIndex))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(data), nil
+}
+
+//GetRoot returns the state root of the last commit
+func (s *State) GetRoot() common.Hash {
+	data, _ := s.db.Get(rootKey)
+	return common.BytesToHash(data)
+}
+
+//SetHead rewinds the chain to the block with the given index and state root.
+//Blocks above it are deleted, and the main StateDB, WAS and TxPool are reset to
+//the root.
+func (s *State) SetHead(blockIndex int64, root common.Hash) error {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	if blockIndex > s.blockIndex {
+		return fmt.Errorf("cannot set head to %d, above current head %d", blockIndex, s.blockIndex)
+	}
+	if _, err := s.ethState.Database().OpenTrie(root); err != nil {
+		return fmt.Errorf("state of block %d is not available: %v", blockIndex, err)
+	}
+
+	batch := s.db.NewBatch()
+	for index := s.blockIndex; index > blockIndex; index-- {
+		if err := s.deleteBlock(batch, index); err != nil {
+			s.logger.WithError(err).WithField("block", index).Error("Deleting block")
+			return err
+		}
+	}
+	if err := s.writeCommit(batch, blockIndex, root); err != nil {
+		return err
+	}
+
+	if err := s.reset(blockIndex, root); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"block": blockIndex,
+		"root":  root.Hex(),
+	}).Info("Set head")
+
+	return nil
+}
+
+//Rewind sets the head of the chain back to an earlier block, using the state
+//root recorded for it. Blocks above it, with their transactions and receipts,
+//are deleted.
+func (s *State) Rewind(blockIndex int64) error {
+	root, err := s.GetBlockRoot(blockIndex)
+	if err != nil {
+		return fmt.Errorf("no state root recorded for block %d", blockIndex)
+	}
+	return s.SetHead(blockIndex, root)
+}
+
+//deleteBlock adds to a batch the deletion of a block, its transactions, their
+//receipts and errors, and the root and diff recorded for the block
+func (s *State) deleteBlock(batch ethdb.Batch, blockIndex int64) error {
+	block, err := s.GetBlockById(blockIndex)
+	if err == nil {
+		hash, _ := block.BlockHash()
+		if err := batch.Delete(hash); err != nil {
+			return err
+		}
+		for _, txBytes := range block.Transactions() {
+			var t ethTypes.Transaction
+			if err := rlp.DecodeBytes(txBytes, &t); err != nil {
+				continue
+			}
+			if err := deleteTransaction(batch, t.Hash()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch.Delete(blockKey(blockIndex)); err != nil {
+		return err
+	}
+	if err := batch.Delete(blockDiffKey(blockIndex)); err != nil {
+		return err
+	}
+	return batch.Delete(blockRootKey(blockIndex))
+}
+
+//deleteTransaction adds to a batch the deletion of a transaction, and of its
+//receipt or error
+func deleteTransaction(batch ethdb.Batch, txHash common.Hash) error {
+	if err := batch.Delete(txHash.Bytes()); err != nil {
+		return err
+	}
+	if err := batch.Delete(append(receiptsPrefix, txHash[:]...)); err != nil {
+		return err
+	}
+	return batch.Delete(append(errorPrefix, txHash[:]...))
 }
 
 //++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
@@ -258,77 +491,38 @@ func (s *State) PrintTransaction(tx *ethTypes.Transaction) string {
 	)
 }
 
-//applyTransaction applies a transaction to the WAS
-func (s *State) applyTransaction(txBytes []byte, txIndex int, blockHash common.Hash) error {
-
+//applyTransaction applies a transaction to the WAS. The block index and time are
+//made available to the EVM through the NUMBER and TIMESTAMP opcodes.
+//
+//Blocks are final, so a transaction which cannot be applied (undecodable,
+//invalid signature, nonce, balance, gas limit...) does not abort the block.
+//Instead it is given a failed receipt which leaves the state untouched, and the
+//reason is recorded as a TxError. The returned error only indicates why the
+//transaction was rejected; every node processing the same block obtains the
+//same receipts and state root.
+func (s *State) applyTransaction(txBytes []byte, txIndex int, blockHash common.Hash, blockIndex int64, blockTime int64) error {
+
+	//An undecodable transaction is only recorded in the block: it has no
+	//transaction entry to go with a receipt
 	var t ethTypes.Transaction
 	if err := rlp.Decode(bytes.NewReader(txBytes), &t); err != nil {
 		s.logger.WithError(err).Error("Decoding Transaction")
+		s.was.txIndex++
 		return err
 	}
 	s.logger.WithField("hash", t.Hash().Hex()).Debug("Decoded tx")
 	s.logger.WithField("tx", s.PrintTransaction(&t)).Debug("Decoded tx")
 
-	msg, err := t.AsMessage(s.signer)
+	receipt, err := s.applyTx(&t, txIndex, blockContext{
+		Hash:  blockHash,
+		Index: blockIndex,
+		Time:  blockTime,
+	})
 	if err != nil {
-		s.logger.WithError(err).Error("Converting Transaction to Message")
-		return err
-	}
-
-	context := vm.Context{
-		CanTransfer: core.CanTransfer,
-		Transfer:    core.Transfer,
-		GetHash:     func(uint64) common.Hash { return blockHash },
-		// Message information
-		Origin:      msg.From(),
-		GasLimit:    msg.Gas(),
-		GasPrice:    msg.GasPrice(),
-		BlockNumber: big.NewInt(0), //the vm has a dependency on this..
-	}
-	s.logger.WithFields(logrus.Fields{
-		"GasLimit": msg.Gas(),
-		"s.was.gp": s.was.gp,
-	}).Debug("state.ApplyTransaction")
-
-	//Prepare the ethState with transaction Hash so that it can be used in emitted
-	//logs
-	s.was.ethState.Prepare(t.Hash(), blockHash, txIndex)
-
-	// The EVM should never be reused and is not thread safe.
-	vmenv := vm.NewEVM(context, s.was.ethState, &s.chainConfig, s.vmConfig)
-
-	// Apply the transaction to the current state (included in the env)
-	_, gas, failed, err := core.ApplyMessage(vmenv, msg, s.was.gp)
-	if err != nil {
-		txError := TxError{
-			Tx:    t,
-			Error: err.Error(),
-		}
-		txHash := t.Hash()
-		txErrorMarshal, _ := txError.Marshal()
-		if err := s.db.Put(append(errorPrefix, txHash[:]...), txErrorMarshal); err != nil {
-			s.logger.WithError(err).Error("s.db.Put")
-		}
 		s.logger.WithError(err).Error("Applying transaction to State")
-		return err
-	}
-
-	s.was.totalUsedGas.Add(s.was.totalUsedGas, big.NewInt(0).SetUint64(gas))
-
-	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
-	// based on the eip phase, we're passing whether the root touch-delete accounts.
-	root := s.was.ethState.IntermediateRoot(true) //this has side effects. It updates StateObjects (SmartContract memory)
-	receipt := ethTypes.NewReceipt(root.Bytes(), failed, bcommon.BigintToUInt64(s.was.totalUsedGas))
-	receipt.TxHash = t.Hash()
-	receipt.GasUsed = gas
-	// if the transaction created a contract, store the creation address in the receipt.
-	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, t.Nonce())
+		s.was.txErrors = append(s.was.txErrors, TxError{Tx: t, Error: err.Error()})
+		receipt = newFailedReceipt(s.was.ethState, s.was.totalUsedGas, t.Hash())
 	}
-	// Set the receipt logs and create a bloom for filtering
-	receipt.Logs = s.was.ethState.GetLogs(t.Hash())
-	//receipt.Logs = s.was.state.Logs()
-	receipt.Bloom = ethTypes.CreateBloom(ethTypes.Receipts{receipt})
 
 	s.was.txIndex++
 	s.was.transactions = append(s.was.transactions, &t)
@@ -337,43 +531,55 @@ func (s *State) applyTransaction(txBytes []byte, txIndex int, blockHash common.H
 
 	s.logger.WithField("hash", t.Hash().Hex()).Debug("Applied tx to WAS")
 
-	return nil
+	return err
+}
+
+//applyTx executes a decoded transaction on the WAS
+func (s *State) applyTx(t *ethTypes.Transaction, txIndex int, block blockContext) (*ethTypes.Receipt, error) {
+	msg, err := s.asMessage(t)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"GasLimit": msg.Gas(),
+		"s.was.gp": s.was.gp,
+	}).Debug("state.ApplyTransaction")
+
+	receipt, _, err := applyMessage(s.was.ethState,
+		&s.chainConfig,
+		s.vmConfig,
+		s.was.gp,
+		&s.was.totalUsedGas,
+		block,
+		msg,
+		t.Hash(),
+		txIndex)
+
+	return receipt, err
 }
 
 //Commit persists all pending state changes (in the WAS) to the DB, and resets
 //the WAS and TxPool
 func (s *State) Commit() (common.Hash, error) {
+	batch := s.db.NewBatch()
+
 	//commit all state changes to the database
-	root, err := s.was.Commit()
+	root, err := s.was.Commit(batch, true)
 	if err != nil {
 		s.logger.WithError(err).Error("Committing WAS")
 		return root, err
 	}
-
-	// reset the write ahead state for the next block
-	// with the latest eth state
-	/*s.ethState = s.was.ethState
-	s.logger.WithField("root", root.Hex()).Debug("Committed")
-	s.resetWAS()*/
-	if err := s.ethState.Reset(root); err != nil {
-		s.logger.WithError(err).Error("Resetting main StateDB")
-		return root, err
-	}
-	s.logger.WithField("root", root.Hex()).Debug("Committed")
-
-	//Reset WAS
-	if err := s.was.Reset(root); err != nil {
-		s.logger.WithError(err).Error("Resetting WAS")
+	if err := s.writeCommit(batch, s.blockIndex, root); err != nil {
+		s.logger.WithError(err).Error("Writing commit")
 		return root, err
 	}
-	s.logger.Debug("Reset WAS")
 
-	//Reset TxPool
-	if err := s.txPool.Reset(root); err != nil {
-		s.logger.WithError(err).Error("Resetting TxPool")
+	//reset the main StateDB, WAS and TxPool with the latest state
+	if err := s.reset(s.blockIndex, root); err != nil {
 		return root, err
 	}
-	s.logger.Debug("Reset TxPool")
+	s.logger.WithField("root", root.Hex()).Debug("Committed")
 
 	return root, nil
 }
@@ -383,14 +589,17 @@ func (s *State) resetWAS() {
 	s.was = &WriteAheadState{
 		db:           s.db,
 		ethState:     state,
+		signer:       s.signer,
+		chainConfig:  s.chainConfig,
+		vmConfig:     s.vmConfig,
 		txIndex:      0,
-		totalUsedGas: big.NewInt(0),
-		gp:           new(core.GasPool).AddGas(gasLimit.Uint64()),
+		totalUsedGas: 0,
+		gp:           new(core.GasPool).AddGas(s.gasLimit),
 		logger:       s.logger,
-		gasLimit:     gasLimit.Uint64(),
+		gasLimit:     s.gasLimit,
 	}
 	s.logger.WithFields(logrus.Fields{
-		"gasLimit": gasLimit.Uint64(),
+		"gasLimit": s.gasLimit,
 		"s.was.gp": s.was.gp,
 	}).Debug("Reset Write Ahead State")
 }
@@ -431,6 +640,11 @@ func (s *State) InitState() error {
 
 	// Use root instead
 
+	//roll back a commit which was interrupted halfway
+	if err := s.repairCommit(); err != nil {
+		return err
+	}
+
 	//get root hash
 	data, _ := s.db.Get(rootKey)
 	if len(data) != 0 {
@@ -438,20 +652,38 @@ func (s *State) InitState() error {
 		s.logger.WithField("root", rootHash.Hex()).Debug("Existing State Root")
 	}
 
+	//get head block index
+	data, _ = s.db.Get(headBlockKey)
+	if len(data) == 8 {
+		s.blockIndex = int64(binary.BigEndian.Uint64(data))
+		s.logger.WithField("block_index", s.blockIndex).Debug("Existing Head Block")
+	}
+
 	//use root to initialise the state
 	var err error
 
-	s.ethState, err = ethState.New(rootHash, ethState.NewDatabase(s.db))
+	db := ethState.NewDatabase(s.db)
+
+	//the head state may be missing if the node ran in pruned mode and stopped
+	//before flushing it
+	if _, err := db.OpenTrie(rootHash); err != nil {
+		s.logger.WithError(err).Warn("Head state missing")
+		if rootHash, err = s.recoverHead(db); err != nil {
+			return err
+		}
+	}
+
+	s.ethState, err = ethState.New(rootHash, db)
 	if err != nil {
 		return err
 	}
 
-	s.was, err = NewWriteAheadState(s.db, rootHash, s.signer, s.chainConfig, s.vmConfig, gasLimit.Uint64(), s.logger)
+	s.was, err = NewWriteAheadState(s.db, rootHash, s.signer, s.chainConfig, s.vmConfig, s.gasLimit, s.logger)
 	if err != nil {
 		return err
 	}
 
-	s.txPool = NewTxPool(s.ethState.Copy(), s.signer, s.chainConfig, s.vmConfig, gasLimit.Uint64(), s.logger)
+	s.txPool = NewTxPool(s.ethState.Copy(), s.signer, s.chainConfig, s.vmConfig, s.gasLimit, s.logger)
 
 	return err
 }
@@ -464,39 +696,33 @@ func (s *State) CheckTx(tx *ethTypes.Transaction) error {
 	return s.txPool.CheckTx(tx)
 }
 
-//ApplyTransaction decodes a transaction and applies it to the WAS. It is meant
-//to be called by the consensus system to apply transactions sequentially.
+//ApplyTransaction decodes a transaction and applies it to the WAS, as part of
+//the block following the last processed one. Consensus systems should use
+//ProcessBlock, which applies whole blocks deterministically; this is mostly
+//useful for tests. A rejected transaction still gets a failed receipt, unless
+//it can't be decoded, but the error is returned.
 func (s *State) ApplyTransaction(txBytes []byte, txIndex int, blockHash common.Hash) error {
+	return s.applyTransaction(txBytes, txIndex, blockHash, s.blockIndex+1, 0)
+}
 
-	var t ethTypes.Transaction
-	if err := rlp.Decode(bytes.NewReader(txBytes), &t); err != nil {
-		s.logger.WithError(err).Error("Decoding Transaction")
-		return err
+//Close flushes the head state, if it is only kept in memory, and closes the
+//underlying database
+func (s *State) Close() {
+	if err := s.flushHead(); err != nil {
+		s.logger.WithError(err).Error("Flushing head state")
 	}
-	s.logger.WithField("hash", t.Hash().Hex()).Debug("Decoded tx")
-
-	return s.was.ApplyTransaction(t, txIndex, blockHash)
+	s.db.Close()
 }
 
-func (s *State) CreateAccounts(accounts bcommon.AccountMap) error {
-	s.commitMutex.Lock()
-	defer s.commitMutex.Unlock()
-
-	for addr, account := range accounts {
-		address := common.HexToAddress(addr)
-		if !s.Exist(address) {
-			s.was.ethState.AddBalance(address, math.MustParseBig256(account.Balance))
-			s.was.ethState.SetCode(address, common.Hex2Bytes(account.Code))
-			for key, value := range account.Storage {
-				s.was.ethState.SetState(address, common.HexToHash(key), common.HexToHash(value))
-			}
-			s.logger.WithField("address", addr).Debug("Adding account")
-		}
+//GetPreimage returns the preimage of a hash, if known. Preimages of account
+//addresses and storage keys are written along with the state tries. Other
+//preimages (hashes computed by the EVM) are only recorded when enabled.
+func (s *State) GetPreimage(hash common.Hash) ([]byte, error) {
+	preimage, err := s.db.Get(preimageKey(hash))
+	if err != nil {
+		return nil, fmt.Errorf("unknown preimage of %s", hash.Hex())
 	}
-
-	_, err := s.Commit()
-
-	return err
+	return preimage, nil
 }
 
 //Exist reports whether the given account address exists in the state.
@@ -508,10 +734,83 @@ func (s *State) GetBalance(addr common.Address) *big.Int {
 	return s.ethState.GetBalance(addr)
 }
 
+//GetCode returns the code of an account in the committed state.
+func (s *State) GetCode(addr common.Address) []byte {
+	return s.ethState.GetCode(addr)
+}
+
+//GetStorageAt returns the value of a storage slot of an account in the
+//committed state.
+func (s *State) GetStorageAt(addr common.Address, key common.Hash) common.Hash {
+	return s.ethState.GetState(addr, key)
+}
+
 func (s *State) GetNonce(addr common.Address) uint64 {
 	return s.was.ethState.GetNonce(addr)
 }
 
+//accountStateAt returns the state after the block with the given index
+func (s *State) accountStateAt(blockIndex int64) (*ethState.StateDB, error) {
+	root, err := s.rootAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return ethState.New(root, s.ethState.Database())
+}
+
+//GetBalanceAt returns the balance of an account after the block with the
+//given index, or in the committed state if blockIndex is negative.
+func (s *State) GetBalanceAt(addr common.Address, blockIndex int64) (*big.Int, error) {
+	if blockIndex < 0 {
+		return s.GetBalance(addr), nil
+	}
+	statedb, err := s.accountStateAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetBalance(addr), nil
+}
+
+//GetCodeAt returns the code of an account after the block with the given
+//index, or in the committed state if blockIndex is negative.
+func (s *State) GetCodeAt(addr common.Address, blockIndex int64) ([]byte, error) {
+	if blockIndex < 0 {
+		return s.GetCode(addr), nil
+	}
+	statedb, err := s.accountStateAt(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(addr), nil
+}
+
+//GetStorageAtBlock returns the value of a storage slot of an account after the
+//block with the given index, or in the committed state if blockIndex is
+//negative.
+func (s *State) GetStorageAtBlock(addr common.Address, key common.Hash, blockIndex int64) (common.Hash, error) {
+	if blockIndex < 0 {
+		return s.GetStorageAt(addr, key), nil
+	}
+	statedb, err := s.accountStateAt(blockIndex)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return statedb.GetState(addr, key), nil
+}
+
+//GetNonceAt returns the nonce of an account after the block with the given
+//index, or in the WAS if blockIndex is negative.
+func (s *State) GetNonceAt(addr common.Address, blockIndex int64) (uint64, error) {
+	if blockIndex < 0 {
+		return s.GetNonce(addr), nil
+	}
+	statedb, err := s.accountStateAt(blockIndex)
+	if err != nil {
+		return 0, err
+	}
+	return statedb.GetNonce(addr), nil
+}
+
 //GetPoolNonce returns an account's nonce from the txpool's ethState
 func (s *State) GetPoolNonce(addr common.Address) uint64 {
 	return s.txPool.ethState.GetNonce(addr)
@@ -1,7 +1,7 @@
 package state
 
 import (
-	"encoding/json"
+	"bytes"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"io/ioutil"
 	"math/big"
@@ -10,16 +10,19 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/sirupsen/logrus"
 
 	bcommon "github.com/Fantom-foundation/go-evm/src/common"
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
 )
 
 var (
@@ -39,12 +42,17 @@ type Test struct {
 	logger   *logrus.Logger
 }
 
-func NewTest(dataDir string, logger *logrus.Logger, t *testing.T) *Test {
+func NewTest(dataDir string, backend string, logger *logrus.Logger, t *testing.T) *Test {
 	pwdFile := filepath.Join(dataDir, "pwd.txt")
 	dbFile := filepath.Join(dataDir, "chaindata")
 	cache := 128
 
-	state, err := NewState(logger, dbFile, cache)
+	db, err := NewDatabase(backend, dbFile, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewState(logger, db, true, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -92,6 +100,24 @@ var removeChainData = func(t *testing.T) {
 	}
 }
 
+var (
+	// backends are the storage backends which the state tests run against
+	backends = []string{LevelDBBackend, MemoryBackend, BadgerBackend}
+	// persistentBackends are the backends which survive a restart
+	persistentBackends = []string{LevelDBBackend, BadgerBackend}
+)
+
+// forEachBackend runs a test against each of the given backends, so that every
+// backend goes through the same state tests
+func forEachBackend(t *testing.T, backends []string, test func(*testing.T, string)) {
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			test(t, backend)
+		})
+	}
+}
+
 func (test *Test) unlockAccounts() error {
 	pwd, err := test.readPwd()
 	if err != nil {
@@ -108,26 +134,14 @@ func (test *Test) unlockAccounts() error {
 	return nil
 }
 
-func (test *Test) createGenesisAccounts() error {
-	genesisFile := filepath.Join(test.dataDir, "genesis.json")
-
-	contents, err := ioutil.ReadFile(genesisFile)
+func (test *Test) initGenesis() error {
+	genesis, err := LoadGenesis(filepath.Join(test.dataDir, "genesis.json"))
 	if err != nil {
 		return err
 	}
 
-	var genesis struct {
-		Alloc bcommon.AccountMap
-	}
-
-	if err := json.Unmarshal(contents, &genesis); err != nil {
-		return err
-	}
-
-	if err := test.state.CreateAccounts(genesis.Alloc); err != nil {
-		return err
-	}
-	return nil
+	_, err = test.state.InitGenesis(genesis)
+	return err
 }
 
 func (test *Test) Init() error {
@@ -139,7 +153,7 @@ func (test *Test) Init() error {
 		return err
 	}
 
-	if err := test.createGenesisAccounts(); err != nil {
+	if err := test.initGenesis(); err != nil {
 		return err
 	}
 
@@ -224,10 +238,14 @@ func (test *Test) deployContract(from accounts.Account, contract *Contract, t *t
 
 //------------------------------------------------------------------------------
 func TestTransfer(t *testing.T) {
+	forEachBackend(t, backends, testTransfer)
+}
+
+func testTransfer(t *testing.T, backend string) {
 	removeChainData(t)
 	defer removeChainData(t)
 
-	test := NewTest("test_data/eth", bcommon.NewTestLogger(t), t)
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
 	defer test.state.db.Close()
 
 	err := test.Init()
@@ -355,7 +373,7 @@ func callDummyContractTest(test *Test, from accounts.Account, contract *Contract
 		t.Fatal(err)
 	}
 
-	res, err := test.state.Call(callMsg)
+	res, err := test.state.Call(callMsg, nil, -1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -416,10 +434,14 @@ func callDummyContractTestAsync(test *Test, from accounts.Account, contract *Con
 }
 
 func TestCreateContract(t *testing.T) {
+	forEachBackend(t, backends, testCreateContract)
+}
+
+func testCreateContract(t *testing.T, backend string) {
 	removeChainData(t)
 	defer removeChainData(t)
 
-	test := NewTest("test_data/eth", bcommon.NewTestLogger(t), t)
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
 	defer test.state.db.Close()
 
 	err := test.Init()
@@ -447,12 +469,132 @@ func TestCreateContract(t *testing.T) {
 
 }
 
+func TestCallBlock(t *testing.T) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", LevelDBBackend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	contract := dummyContract()
+	contract.parseABI(t)
+
+	processTx := func(index, created int64, to *accounts.Account, data []byte) *ethTypes.Transaction {
+		tx, err := test.prepareTransaction(&from, to, _defaultValue, _defaultGas, _defaultGasPrice, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txBytes, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(index, index, nil, [][]byte{txBytes})
+		block.CreatedTime = created
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	// Deploy the contract in block 1, and change its state in block 2
+	tx := processTx(1, 1000, nil, common.FromHex(contract.code))
+	receipt, err := test.state.GetReceipt(tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract.address = receipt.ContractAddress
+
+	asyncData, err := contract.jsonABI.Pack("testAsync", big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	processTx(2, 2000, &accounts.Account{Address: contract.address}, asyncData)
+
+	call := func(to common.Address, data []byte, overrides StateOverride, blockIndex int64) []byte {
+		msg := ethTypes.NewMessage(from.Address, &to, 0, _defaultValue, _defaultGas, _defaultGasPrice, data, false)
+		res, err := test.state.Call(msg, overrides, blockIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	testData, err := contract.jsonABI.Pack("test", big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callTest := func(overrides StateOverride, blockIndex int64) int64 {
+		var res *big.Int
+		if err := contract.jsonABI.Unpack(&res, "test", call(contract.address, testData, overrides, blockIndex)); err != nil {
+			t.Fatal(err)
+		}
+		return res.Int64()
+	}
+
+	if res := callTest(nil, 1); res != 10 {
+		t.Fatalf("call on block 1 should return 10, not %d", res)
+	}
+	if res := callTest(nil, 2); res != 110 {
+		t.Fatalf("call on block 2 should return 110, not %d", res)
+	}
+	if res := callTest(nil, -1); res != 110 {
+		t.Fatalf("call on the last block should return 110, not %d", res)
+	}
+
+	// Overrides apply on top of the state of the selected block
+	slots := map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5))}
+	overrides := StateOverride{contract.address: {StateDiff: &slots}}
+	if res := callTest(overrides, 1); res != 50 {
+		t.Fatalf("call with overridden storage should return 50, not %d", res)
+	}
+	if res := callTest(nil, 1); res != 10 {
+		t.Fatal("overrides should not be persisted")
+	}
+
+	// The EVM sees the number and time of the selected block:
+	// NUMBER or TIMESTAMP, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+	probe := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	probeCode := func(op byte) StateOverride {
+		code := hexutil.Bytes{op, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3}
+		return StateOverride{probe: {Code: &code}}
+	}
+	for _, c := range []struct {
+		blockIndex int64
+		number     int64
+		time       int64
+	}{
+		{1, 1, 1000},
+		{2, 2, 2000},
+		{-1, 2, 2000},
+	} {
+		if number := new(big.Int).SetBytes(call(probe, nil, probeCode(0x43), c.blockIndex)).Int64(); number != c.number {
+			t.Fatalf("call on block %d should see number %d, not %d", c.blockIndex, c.number, number)
+		}
+		if time := new(big.Int).SetBytes(call(probe, nil, probeCode(0x42), c.blockIndex)).Int64(); time != c.time {
+			t.Fatalf("call on block %d should see time %d, not %d", c.blockIndex, c.time, time)
+		}
+	}
+
+	msg := ethTypes.NewMessage(from.Address, &contract.address, 0, _defaultValue, _defaultGas, _defaultGasPrice, testData, false)
+	if _, err := test.state.Call(msg, nil, 3); err == nil {
+		t.Fatal("call on an unknown block should fail")
+	}
+}
+
 func TestDB(t *testing.T) {
+	forEachBackend(t, persistentBackends, testDB)
+}
+
+func testDB(t *testing.T, backend string) {
 	removeChainData(t)
 	defer removeChainData(t)
 
 	// Initialise a fresh instance and commit stuff to the db
-	test := NewTest("test_data/eth", bcommon.NewTestLogger(t), t)
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
 	if err := test.Init(); err != nil {
 		t.Fatal(err)
 	}
@@ -475,7 +617,7 @@ func TestDB(t *testing.T) {
 	test.state.db.Close()
 
 	// Initialise another instance from the existing db
-	test2 := NewTest("test_data/eth", bcommon.NewTestLogger(t), t)
+	test2 := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
 	if err := test2.Init(); err != nil {
 		t.Fatal(err)
 	}
@@ -493,3 +635,1491 @@ func TestDB(t *testing.T) {
 	callDummyContractTest(test2, from, contract, big.NewInt(110), t)
 
 }
+
+func TestSnapshotRestore(t *testing.T) {
+	forEachBackend(t, backends, testSnapshotRestore)
+}
+
+func testSnapshotRestore(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+
+	contract := dummyContract()
+	contract.parseABI(t)
+
+	// Deploy the contract in block 1
+	tx, err := test.prepareTransaction(&from,
+		nil,
+		_defaultValue,
+		_defaultGas,
+		_defaultGasPrice,
+		common.FromHex(contract.code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := poset.NewBlock(1, 1, nil, [][]byte{data})
+	root, err := test.state.ProcessBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := test.state.GetReceipt(tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract.address = receipt.ContractAddress
+
+	snapshot, err := test.state.GetSnapshot(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots must be deterministic
+	snapshot2, err := test.state.GetSnapshot(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot, snapshot2) {
+		t.Fatal("snapshots of the same block should be identical")
+	}
+
+	// Restore into a fresh State
+	restoreDir, err := ioutil.TempDir("", "evm-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restoreDir)
+
+	restoredDB, err := NewDatabase(backend, filepath.Join(restoreDir, "chaindata"), test.cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewState(test.logger, restoredDB, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.db.Close()
+	if err := (&Test{state: restored, dataDir: test.dataDir}).initGenesis(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new node needs a trusted root for the block
+	if _, err := restored.Restore(snapshot); err == nil {
+		t.Fatal("restoring a snapshot without a trusted root should fail")
+	}
+	restored.TrustBlockRoot(1, common.HexToHash("0x01"))
+	if _, err := restored.Restore(snapshot); err == nil {
+		t.Fatal("restoring a snapshot which does not match the trusted root should fail")
+	}
+	restored.TrustBlockRoot(1, root)
+
+	restoredRoot, err := restored.Restore(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restoredRoot != root {
+		t.Fatalf("restored root should be %s, not %s", root.Hex(), restoredRoot.Hex())
+	}
+	if restored.GetBlockIndex() != 1 {
+		t.Fatalf("restored block index should be 1, not %d", restored.GetBlockIndex())
+	}
+	if err := restored.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.GetBalance(from.Address).Cmp(test.state.GetBalance(from.Address)) != 0 {
+		t.Fatal("restored balance should match")
+	}
+
+	// Contract code and storage must have been restored
+	test2 := &Test{state: restored, logger: test.logger}
+	callDummyContractTest(test2, from, contract, big.NewInt(10), t)
+
+	// And the preimages of the account addresses
+	preimage, err := restored.GetPreimage(crypto.Keccak256Hash(from.Address.Bytes()))
+	if err != nil || common.BytesToAddress(preimage) != from.Address {
+		t.Fatal("preimage of the account address should be restored")
+	}
+	modified, err := restored.GetModifiedAccounts(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := test.state.GetModifiedAccounts(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(modified, expected) {
+		t.Fatalf("modified accounts should be %v, not %v", expected, modified)
+	}
+
+	// A tampered snapshot must be rejected
+	var tampered Snapshot
+	if err := tampered.Unmarshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	tampered.Accounts[0].Nonce++
+	tamperedData, err := tampered.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Restore(tamperedData); err == nil {
+		t.Fatal("restoring a tampered snapshot should fail")
+	}
+
+	var badPreimage Snapshot
+	if err := badPreimage.Unmarshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	badPreimage.Accounts[0].Preimage = common.HexToAddress("0x01").Bytes()
+	badPreimageData, err := badPreimage.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Restore(badPreimageData); err == nil {
+		t.Fatal("restoring a snapshot with an invalid preimage should fail")
+	}
+
+	// A snapshot of another chain must be rejected
+	var other Snapshot
+	if err := other.Unmarshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	other.Genesis = common.HexToHash("0x01")
+	otherData, err := other.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Restore(otherData); err == nil {
+		t.Fatal("restoring a snapshot of another genesis should fail")
+	}
+
+	// Restoring below the head deletes the blocks above the snapshot
+	to := test.keyStore.Accounts()[1]
+	var txs []*ethTypes.Transaction
+	for i := int64(2); i <= 3; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.state.ProcessBlock(poset.NewBlock(i, i, nil, [][]byte{data})); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	if _, err := test.state.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if test.state.GetBlockIndex() != 1 || test.state.GetRoot() != root {
+		t.Fatalf("head should be back at block 1, not %d", test.state.GetBlockIndex())
+	}
+	for i, tx := range txs {
+		index := int64(i) + 2
+		if _, err := test.state.GetBlockById(index); err == nil {
+			t.Fatalf("block %d should be deleted", index)
+		}
+		if _, err := test.state.GetBlockRoot(index); err == nil {
+			t.Fatalf("root of block %d should be deleted", index)
+		}
+		if _, err := test.state.GetReceipt(tx.Hash()); err == nil {
+			t.Fatalf("receipt of block %d should be deleted", index)
+		}
+	}
+	if err := test.state.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	// and the chain goes on from the snapshot
+	if _, err := test.state.ProcessBlock(poset.NewBlock(2, 2, nil, [][]byte{})); err != nil {
+		t.Fatal(err)
+	}
+	if test.state.GetBlockIndex() != 2 {
+		t.Fatalf("head should be block 2, not %d", test.state.GetBlockIndex())
+	}
+}
+
+func TestProcessBlockFailedTx(t *testing.T) {
+	forEachBackend(t, backends, testProcessBlockFailedTx)
+}
+
+func testProcessBlockFailedTx(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+	toBalanceBefore := test.state.GetBalance(to.Address)
+
+	value := big.NewInt(1000000)
+	gas := uint64(21000)
+
+	tx1, err := test.prepareTransaction(&from, &to, value, gas, _defaultGasPrice, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same nonce as tx1 (but different value): rejected once tx1 has been
+	// applied
+	tx2, err := test.prepareTransaction(&from, &to, big.NewInt(1), gas, _defaultGasPrice, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var txs [][]byte
+	for _, tx := range []*ethTypes.Transaction{tx1, tx2} {
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, data)
+	}
+	// Undecodable transaction
+	txs = append(txs, []byte("garbage"))
+
+	block := poset.NewBlock(1, 1, nil, txs)
+	if _, err := test.state.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt1, err := test.state.GetReceipt(tx1.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt1.Status != ethTypes.ReceiptStatusSuccessful {
+		t.Fatal("first transaction should succeed")
+	}
+
+	receipt2, err := test.state.GetReceipt(tx2.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt2.Status != ethTypes.ReceiptStatusFailed {
+		t.Fatal("second transaction should have a failed receipt")
+	}
+	if receipt2.GasUsed != 0 {
+		t.Fatalf("failed transaction should use no gas, not %d", receipt2.GasUsed)
+	}
+	if _, err := test.state.GetFailedTx(tx2.Hash()); err != nil {
+		t.Fatal("failure reason should be recorded")
+	}
+	if _, err := test.state.GetReceipt(crypto.Keccak256Hash([]byte("garbage"))); err == nil {
+		t.Fatal("undecodable transaction should have no receipt")
+	}
+	if err := test.state.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedToBalance := new(big.Int).Add(toBalanceBefore, value)
+	if toBalance := test.state.GetBalance(to.Address); toBalance.Cmp(expectedToBalance) != 0 {
+		t.Fatalf("toBalance should be %v, not %v", expectedToBalance, toBalance)
+	}
+}
+
+func TestBlockTime(t *testing.T) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", LevelDBBackend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		created  int64
+		expected int64
+	}{
+		{1000, 1000},
+		{500, 1000}, //blocks don't go back in time
+		{0, 1000},   //nor take the local time
+		{1001, 1001},
+	}
+	for i, c := range cases {
+		index := int64(i + 1)
+		block := poset.NewBlock(index, index, nil, nil)
+		block.CreatedTime = c.created
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		processed, err := test.state.GetBlockById(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if processed.GetCreatedTime() != c.expected {
+			t.Fatalf("block %d time should be %d, not %d", index, c.expected, processed.GetCreatedTime())
+		}
+
+		//the block is stored under the hash of what was executed
+		hash, err := processed.BlockHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.state.GetBlock(common.BytesToHash(hash)); err != nil {
+			t.Fatalf("block %d should be found by its hash: %v", index, err)
+		}
+	}
+
+	if err := test.state.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	forEachBackend(t, backends, testImpersonation)
+}
+
+func testImpersonation(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	to := test.keyStore.Accounts()[0]
+	toBalanceBefore := test.state.GetBalance(to.Address)
+
+	if err := test.state.SetBalance(from, big.NewInt(1000000)); err != ErrDevModeDisabled {
+		t.Fatalf("SetBalance should fail outside dev mode, not return %v", err)
+	}
+
+	test.state.EnableDevMode()
+
+	if err := test.state.SetBalance(from, big.NewInt(1000000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.state.SetNonce(from, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	value := big.NewInt(1000)
+	tx := ethTypes.NewTransaction(5, to.Address, value, 21000, _defaultGasPrice, nil)
+
+	if _, err := test.state.ImpersonatedTx(tx, from); err != ErrNotImpersonated {
+		t.Fatalf("ImpersonatedTx should fail for an account which is not impersonated, not return %v", err)
+	}
+	if err := test.state.ImpersonateAccount(from); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := test.state.ImpersonatedTx(tx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender, err := test.state.Sender(signed); err != nil || sender != from {
+		t.Fatalf("Sender should be %v, not %v (%v)", from.Hex(), sender.Hex(), err)
+	}
+
+	data, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := poset.NewBlock(test.state.GetBlockIndex()+1, 1, nil, [][]byte{data})
+	if _, err := test.state.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := test.state.GetReceipt(signed.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != ethTypes.ReceiptStatusSuccessful {
+		t.Fatal("impersonated transaction should succeed")
+	}
+
+	expectedToBalance := new(big.Int).Add(toBalanceBefore, value)
+	if toBalance := test.state.GetBalance(to.Address); toBalance.Cmp(expectedToBalance) != 0 {
+		t.Fatalf("toBalance should be %v, not %v", expectedToBalance, toBalance)
+	}
+	if nonce := test.state.GetNonce(from); nonce != 6 {
+		t.Fatalf("nonce should be 6, not %d", nonce)
+	}
+}
+
+func TestStateDiff(t *testing.T) {
+	forEachBackend(t, backends, testStateDiff)
+}
+
+func testStateDiff(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+	value := big.NewInt(1000)
+
+	var toBalanceBefore *big.Int
+	for i := int64(1); i <= 2; i++ {
+		toBalanceBefore = test.state.GetBalance(to.Address)
+
+		tx, err := test.prepareTransaction(&from, &to, value, 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(i, i, nil, [][]byte{data})
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff, err := test.state.GetStateDiff(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 2 {
+		t.Fatalf("block 2 should modify 2 accounts, not %d", len(diff))
+	}
+	for _, account := range diff {
+		if account.Before == nil || account.After == nil {
+			t.Fatalf("account %v should exist before and after block 2", account.Address.Hex())
+		}
+		if account.Address != to.Address {
+			continue
+		}
+		if account.Before.Balance.ToInt().Cmp(toBalanceBefore) != 0 {
+			t.Fatalf("balance before should be %v, not %v", toBalanceBefore, account.Before.Balance.ToInt())
+		}
+		expected := new(big.Int).Add(toBalanceBefore, value)
+		if account.After.Balance.ToInt().Cmp(expected) != 0 {
+			t.Fatalf("balance after should be %v, not %v", expected, account.After.Balance.ToInt())
+		}
+	}
+
+	modified, err := test.state.GetModifiedAccounts(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(modified, diff.Addresses()) {
+		t.Fatalf("modified accounts should be %v, not %v", diff.Addresses(), modified)
+	}
+}
+
+func TestGetProof(t *testing.T) {
+	forEachBackend(t, backends, testGetProof)
+}
+
+func testGetProof(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	missing := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	root := test.state.GetRoot()
+
+	for _, address := range []common.Address{from.Address, missing} {
+		result, err := test.state.GetProof(address, []common.Hash{{}}, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyProof(root, result); err != nil {
+			t.Fatalf("proof of %v should be valid: %v", address.Hex(), err)
+		}
+
+		result.Balance = (*hexutil.Big)(new(big.Int).Add(result.Balance.ToInt(), big.NewInt(1)))
+		if err := VerifyProof(root, result); err == nil {
+			t.Fatalf("proof of %v should not prove a different balance", address.Hex())
+		}
+	}
+}
+
+func TestAccountStateAt(t *testing.T) {
+	forEachBackend(t, backends, testAccountStateAt)
+}
+
+func testAccountStateAt(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+	balances := []*big.Int{test.state.GetBalance(to.Address)}
+	genesisNonce := test.state.GetNonce(from.Address)
+
+	for i := int64(1); i <= 2; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.state.ProcessBlock(poset.NewBlock(i, i, nil, [][]byte{data})); err != nil {
+			t.Fatal(err)
+		}
+		balances = append(balances, test.state.GetBalance(to.Address))
+	}
+
+	for i, expected := range balances {
+		balance, err := test.state.GetBalanceAt(to.Address, int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(expected) != 0 {
+			t.Fatalf("balance after block %d should be %v, not %v", i, expected, balance)
+		}
+		nonce, err := test.state.GetNonceAt(from.Address, int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != genesisNonce+uint64(i) {
+			t.Fatalf("nonce after block %d should be %d, not %d", i, genesisNonce+uint64(i), nonce)
+		}
+	}
+	if balance, err := test.state.GetBalanceAt(to.Address, -1); err != nil || balance.Cmp(balances[2]) != 0 {
+		t.Fatalf("latest balance should be %v, not %v", balances[2], balance)
+	}
+	if code, err := test.state.GetCodeAt(from.Address, 0); err != nil || len(code) != 0 {
+		t.Fatalf("account should have no code, not %x", code)
+	}
+	if value, err := test.state.GetStorageAtBlock(from.Address, common.Hash{}, 1); err != nil || value != (common.Hash{}) {
+		t.Fatalf("account should have no storage, not %v", value.Hex())
+	}
+
+	if _, err := test.state.GetBalanceAt(to.Address, 3); err == nil {
+		t.Fatal("a block which was not processed should be an error")
+	}
+	if _, err := test.state.GetNonceAt(from.Address, 3); err == nil {
+		t.Fatal("a block which was not processed should be an error")
+	}
+}
+
+func TestRewind(t *testing.T) {
+	forEachBackend(t, backends, testRewind)
+}
+
+func testRewind(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	var txs []*ethTypes.Transaction
+	for i := int64(1); i <= 3; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(i, i, nil, [][]byte{data})
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	root1, err := test.state.GetBlockRoot(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.state.Rewind(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if test.state.GetBlockIndex() != 1 {
+		t.Fatalf("head should be block 1, not %d", test.state.GetBlockIndex())
+	}
+	if test.state.GetRoot() != root1 {
+		t.Fatalf("root should be %v, not %v", root1.Hex(), test.state.GetRoot().Hex())
+	}
+	if _, err := test.state.GetReceipt(txs[0].Hash()); err != nil {
+		t.Fatal("receipt of block 1 should be kept")
+	}
+	for i := int64(2); i <= 3; i++ {
+		if _, err := test.state.GetBlockById(i); err == nil {
+			t.Fatalf("block %d should be deleted", i)
+		}
+		if _, err := test.state.GetReceipt(txs[i-1].Hash()); err == nil {
+			t.Fatalf("receipt of block %d should be deleted", i)
+		}
+	}
+	if nonce := test.state.GetPoolNonce(from.Address); nonce != txs[0].Nonce()+1 {
+		t.Fatalf("pool nonce should be reset to %d, not %d", txs[0].Nonce()+1, nonce)
+	}
+}
+
+func TestPruning(t *testing.T) {
+	forEachBackend(t, persistentBackends, testPruning)
+}
+
+func testPruning(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the state of the last block only, and never flush it
+	test.state.EnablePruning(1, test.cache, time.Hour)
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	for i := int64(1); i <= 3; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(i, i, nil, [][]byte{data})
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := test.state.GetProof(to.Address, nil, 3); err != nil {
+		t.Fatalf("state of block 3 should be available: %v", err)
+	}
+	if _, err := test.state.GetProof(to.Address, nil, 1); err == nil {
+		t.Fatal("state of block 1 should be pruned")
+	}
+
+	// Stop without flushing: no block state is on disk
+	test.state.db.Close()
+
+	db, err := NewDatabase(backend, test.dbFile, test.cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewState(test.logger, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.db.Close()
+
+	if restarted.GetBlockIndex() != 0 {
+		t.Fatalf("head should be rewound to 0, not %d", restarted.GetBlockIndex())
+	}
+	if _, err := restarted.GetBlockById(1); err == nil {
+		t.Fatal("blocks without state should be deleted")
+	}
+}
+
+func TestSimulatePruned(t *testing.T) {
+	forEachBackend(t, persistentBackends, testSimulatePruned)
+}
+
+func testSimulatePruned(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the states of the last 2 blocks in memory only
+	test.state.EnablePruning(2, test.cache, time.Hour)
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+	value := big.NewInt(1000)
+
+	for i := int64(1); i <= 2; i++ {
+		tx, err := test.prepareTransaction(&from, &to, value, 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(i, i, nil, [][]byte{data})
+		block.CreatedTime = 1000 * i
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkStates := func() {
+		for i := int64(1); i <= 2; i++ {
+			if _, err := test.state.GetProof(to.Address, nil, i); err != nil {
+				t.Fatalf("state of block %d should still be available: %v", i, err)
+			}
+		}
+	}
+
+	// Nothing changes: the simulated state is the one of the head
+	sim, err := test.state.Simulate(nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.StateDiff) != 0 {
+		t.Fatalf("empty simulation should change nothing, not %v", sim.StateDiff)
+	}
+	checkStates()
+
+	// Replaying the transfer of block 2 on block 1 gives the state of block 2
+	msg := ethTypes.NewMessage(from.Address, &to.Address, 0, value, 21000, _defaultGasPrice, nil, false)
+	sim, err = test.state.Simulate([]ethTypes.Message{msg}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sim.Transactions) != 1 || sim.Transactions[0].Error != "" {
+		t.Fatalf("transfer should be simulated, not %+v", sim.Transactions)
+	}
+	if len(sim.StateDiff) == 0 {
+		t.Fatal("transfer should change the state")
+	}
+	checkStates()
+
+	// The simulated block has the time of its parent
+	probe := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	// TIMESTAMP, PUSH1 0, SSTORE
+	test.state.EnableDevMode()
+	if err := test.state.SetCode(probe, []byte{0x42, 0x60, 0x00, 0x55}); err != nil {
+		t.Fatal(err)
+	}
+	sim, err = test.state.Simulate([]ethTypes.Message{
+		ethTypes.NewMessage(from.Address, &probe, 0, big.NewInt(0), 100000, _defaultGasPrice, nil, false),
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored *StorageDiff
+	for _, account := range sim.StateDiff {
+		if account.Address == probe && len(account.Storage) == 1 {
+			stored = &account.Storage[0]
+		}
+	}
+	if stored == nil || stored.After.Big().Int64() != 2000 {
+		t.Fatalf("simulated block should have the time of block 2, not %+v", sim.StateDiff)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	forEachBackend(t, persistentBackends, testExportImport)
+}
+
+func testExportImport(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	for i := int64(1); i <= 3; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := poset.NewBlock(i, i, nil, [][]byte{data})
+		block.CreatedTime = 1000 * i
+		if _, err := test.state.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exported bytes.Buffer
+	count, err := test.state.ExportChain(&exported, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Fatalf("genesis and 3 blocks should be exported, not %d", count)
+	}
+
+	// Import into a fresh State with the same genesis
+	importDir, err := ioutil.TempDir("", "evm-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(importDir)
+
+	importedDB, err := NewDatabase(backend, filepath.Join(importDir, "chaindata"), test.cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := NewState(test.logger, importedDB, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.db.Close()
+	if err := (&Test{state: imported, dataDir: test.dataDir}).initGenesis(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err = imported.ImportChain(bytes.NewReader(exported.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Fatalf("genesis and 3 blocks should be imported, not %d", count)
+	}
+	if imported.GetBlockIndex() != 3 {
+		t.Fatalf("imported head should be 3, not %d", imported.GetBlockIndex())
+	}
+	for i := int64(0); i <= 3; i++ {
+		root, err := test.state.GetBlockRoot(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		importedRoot, err := imported.GetBlockRoot(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if importedRoot != root {
+			t.Fatalf("block %d: imported root should be %s, not %s", i, root.Hex(), importedRoot.Hex())
+		}
+	}
+	if imported.GetBalance(to.Address).Cmp(test.state.GetBalance(to.Address)) != 0 {
+		t.Fatal("imported balance should match")
+	}
+
+	// Importing again only checks the blocks
+	if _, err := imported.ImportChain(bytes.NewReader(exported.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// A root which does not match is refused
+	var tampered bytes.Buffer
+	block, err := test.state.GetBlockById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := block.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rlp.Encode(&tampered, &exportedBlock{Block: data, Root: common.HexToHash("0x01")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imported.ImportChain(&tampered); err == nil {
+		t.Fatal("a block whose root does not match should be refused")
+	}
+
+	for i := int64(4); i <= 5; i++ {
+		if _, err := test.state.ProcessBlock(poset.NewBlock(i, i, nil, [][]byte{})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exportBlock := func(index int64, root common.Hash) []byte {
+		block, err := test.state.GetBlockById(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := block.ProtoMarshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := rlp.EncodeToBytes(&exportedBlock{Block: data, Root: root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	// A new block whose root does not match is not committed
+	if _, err := imported.ImportChain(bytes.NewReader(exportBlock(4, common.HexToHash("0x01")))); err == nil {
+		t.Fatal("a new block whose root does not match should be refused")
+	}
+	if imported.GetBlockIndex() != 3 {
+		t.Fatalf("head should stay at 3, not %d", imported.GetBlockIndex())
+	}
+	if _, err := imported.GetBlockRoot(4); err == nil {
+		t.Fatal("a refused block should not be recorded")
+	}
+
+	// Blocks must follow the head
+	root5, err := test.state.GetBlockRoot(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imported.ImportChain(bytes.NewReader(exportBlock(5, root5))); err == nil {
+		t.Fatal("a block which does not follow the head should be refused")
+	}
+
+	var next bytes.Buffer
+	if _, err := test.state.ExportChain(&next, 4, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := imported.ImportChain(&next); err != nil {
+		t.Fatal(err)
+	}
+	if imported.GetBlockIndex() != 5 || imported.GetRoot() != root5 {
+		t.Fatalf("blocks should be imported after a refused one, head is %d", imported.GetBlockIndex())
+	}
+}
+
+func TestPruneKeepsGenesis(t *testing.T) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", LevelDBBackend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	for i := int64(1); i <= 2; i++ {
+		tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.state.ProcessBlock(poset.NewBlock(i, i, nil, [][]byte{data})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := test.state.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted == 0 {
+		t.Fatal("the state of block 1 should be deleted")
+	}
+
+	if _, err := test.state.GetProof(to.Address, nil, 1); err == nil {
+		t.Fatal("the state of block 1 should no longer be available")
+	}
+	for _, i := range []int64{0, 2} {
+		if _, err := test.state.GetProof(to.Address, nil, i); err != nil {
+			t.Fatalf("the state of block %d should be kept: %v", i, err)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	forEachBackend(t, backends, testDump)
+}
+
+func testDump(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	contract := dummyContract()
+	contract.parseABI(t)
+
+	// Deploy the contract in block 1, which sets its counter to 1
+	from := test.keyStore.Accounts()[0]
+	tx, err := test.prepareTransaction(&from, nil, _defaultValue, _defaultGas, _defaultGasPrice, common.FromHex(contract.code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := test.state.ProcessBlock(poset.NewBlock(1, 1, nil, [][]byte{data})); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := test.state.GetReceipt(tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract.address = receipt.ContractAddress
+
+	// Add 5 then 7 to the counter in block 2, from two accounts
+	var txs [][]byte
+	for i, increment := range []int64{5, 7} {
+		sender := test.keyStore.Accounts()[i]
+		callData, err := contract.jsonABI.Pack("testAsync", big.NewInt(increment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := test.prepareTransaction(&sender, &accounts.Account{Address: contract.address}, _defaultValue, _defaultGas, _defaultGasPrice, callData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, data)
+	}
+	if _, err := test.state.ProcessBlock(poset.NewBlock(2, 2, nil, txs)); err != nil {
+		t.Fatal(err)
+	}
+
+	contractHash := crypto.Keccak256Hash(contract.address.Bytes())
+	slotHash := crypto.Keccak256Hash(common.Hash{}.Bytes())
+
+	dump, err := test.state.Dump(-1, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dump.Next != nil {
+		t.Fatal("a complete dump has no next account")
+	}
+	account, ok := dump.Accounts[contractHash]
+	if !ok {
+		t.Fatal("contract should be dumped")
+	}
+	if account.Address == nil || *account.Address != contract.address {
+		t.Fatal("contract address should be dumped")
+	}
+	if len(account.Code) == 0 {
+		t.Fatal("contract code should be dumped")
+	}
+	slot, ok := account.Storage[slotHash]
+	if !ok || slot.Key == nil || *slot.Key != (common.Hash{}) || slot.Value.Big().Int64() != 13 {
+		t.Fatalf("contract counter should be dumped as 13, not %+v", account.Storage)
+	}
+
+	// States of previous blocks can be dumped
+	dump, err = test.state.Dump(0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dump.Accounts[contractHash]; ok {
+		t.Fatal("contract should not exist in the genesis")
+	}
+
+	// Dumps can be paginated
+	full, err := test.state.Dump(2, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := 0
+	accountsSeen := make(map[common.Hash]bool)
+	var start []byte
+	for {
+		page, err := test.state.Dump(2, start, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for hash := range page.Accounts {
+			accountsSeen[hash] = true
+		}
+		if page.Next == nil {
+			break
+		}
+		start = page.Next.Bytes()
+	}
+	if pages != len(full.Accounts) || len(accountsSeen) != len(full.Accounts) {
+		t.Fatalf("%d accounts should be dumped one per page, not %d in %d pages",
+			len(full.Accounts), len(accountsSeen), pages)
+	}
+
+	// Storage tries are obtained between the transactions of a block
+	for txIndex, expected := range []int64{1, 6, 13} {
+		storageTrie, err := test.state.StorageTrieAt(2, txIndex, contract.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, err := storageTrie.TryGet(common.Hash{}.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := decodeStorage(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Big().Int64() != expected {
+			t.Fatalf("counter should be %d before tx %d, not %d", expected, txIndex, value.Big().Int64())
+		}
+	}
+	if _, err := test.state.StorageTrieAt(2, 3, contract.address); err == nil {
+		t.Fatal("block 2 only has 2 transactions")
+	}
+	if _, err := test.state.StorageTrieAt(2, -1, contract.address); err == nil {
+		t.Fatal("a negative transaction index should be refused")
+	}
+}
+
+func TestRepairCommit(t *testing.T) {
+	forEachBackend(t, persistentBackends, testRepairCommit)
+}
+
+func testRepairCommit(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := test.state.ProcessBlock(poset.NewBlock(1, 1, nil, [][]byte{data}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of the commit of block 2
+	block := poset.NewBlock(2, 2, nil, nil)
+	blockData, err := block.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := test.state.db.Put(blockKey(2), blockData); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.state.db.Put(rootKey, common.HexToHash("0x01").Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	test.state.db.Close()
+
+	db, err := NewDatabase(backend, test.dbFile, test.cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewState(test.logger, db, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.db.Close()
+
+	if restarted.GetBlockIndex() != 1 {
+		t.Fatalf("head should be block 1, not %d", restarted.GetBlockIndex())
+	}
+	if restarted.GetRoot() != root {
+		t.Fatalf("root should be %v, not %v", root.Hex(), restarted.GetRoot().Hex())
+	}
+	if _, err := restarted.GetBlockById(2); err == nil {
+		t.Fatal("partially committed block 2 should be deleted")
+	}
+	if _, err := restarted.GetReceipt(tx.Hash()); err != nil {
+		t.Fatal("receipt of block 1 should be kept")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", LevelDBBackend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+
+	var tx *ethTypes.Transaction
+	for i := int64(1); i <= 2; i++ {
+		var err error
+		tx, err = test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := test.state.ProcessBlock(poset.NewBlock(i, i, nil, [][]byte{data})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := test.state.Verify(true, filepath.Join(test.dataDir, "genesis.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 3 || report.Transactions != 2 || report.Reexecuted != 2 {
+		t.Fatalf("the genesis, 2 blocks and transactions should be checked, not %+v", report)
+	}
+
+	if err := test.state.db.Delete(append(receiptsPrefix, tx.Hash().Bytes()...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.state.CheckIntegrity(); err == nil {
+		t.Fatal("a missing receipt should be detected")
+	}
+
+	// Every block is required, including the genesis
+	for _, index := range []int64{0, 1} {
+		report, err := test.state.Verify(false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := len(report.Problems)
+		if err := test.state.db.Delete(blockKey(index)); err != nil {
+			t.Fatal(err)
+		}
+		if report, err = test.state.Verify(false, ""); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) != before+1 {
+			t.Fatalf("missing block %d should be detected, not %v", index, report.Problems)
+		}
+	}
+}
+
+func TestGenesis(t *testing.T) {
+	forEachBackend(t, persistentBackends, testGenesis)
+}
+
+func testGenesis(t *testing.T, backend string) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", backend, bcommon.NewTestLogger(t), t)
+
+	genesis := DefaultGenesis()
+	genesis.Config.ChainID = big.NewInt(1337)
+	genesis.Alloc = GenesisAlloc{
+		"0x6cC5F688a315f3dC28A7781717a9A798a59fDA7b": {Balance: "1000", Nonce: 3},
+	}
+
+	hash, err := test.state.InitGenesis(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := common.HexToAddress("0x6cC5F688a315f3dC28A7781717a9A798a59fDA7b")
+	if test.state.GetBalance(address).Int64() != 1000 || test.state.GetNonce(address) != 3 {
+		t.Fatal("genesis account should be allocated")
+	}
+	if test.state.ChainConfig().ChainID.Int64() != 1337 {
+		t.Fatal("chain ID should be taken from the genesis")
+	}
+	test.state.db.Close()
+
+	reopen := func() *State {
+		db, err := NewDatabase(backend, test.dbFile, test.cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewState(test.logger, db, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	restarted := reopen()
+	if h, err := restarted.InitGenesis(genesis); err != nil || h != hash {
+		t.Fatalf("same genesis should be accepted on restart: %v", err)
+	}
+	stored, err := restarted.GetGenesisBlock()
+	if err != nil || stored.Hash() != hash {
+		t.Fatal("genesis block should be stored")
+	}
+	checkGenesisBlock(t, restarted, stored)
+
+	//a database which predates the genesis block only gets it recorded if it
+	//contains the genesis state
+	for _, key := range [][]byte{genesisHashKey, genesisBlockKey, blockKey(0), blockRootKey(0)} {
+		if err := restarted.db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restarted.db.Close()
+
+	other := DefaultGenesis()
+	other.Config.ChainID = big.NewInt(1337)
+	other.Alloc = GenesisAlloc{
+		"0x6cC5F688a315f3dC28A7781717a9A798a59fDA7b": {Balance: "2000"},
+	}
+	restarted = reopen()
+	if _, err := restarted.InitGenesis(other); err == nil {
+		t.Fatal("a genesis whose state is not in the database should be refused")
+	}
+	if h, err := restarted.InitGenesis(genesis); err != nil || h != hash {
+		t.Fatalf("genesis of an existing database should be recorded: %v", err)
+	}
+	checkGenesisBlock(t, restarted, stored)
+	restarted.db.Close()
+
+	restarted = reopen()
+	defer restarted.db.Close()
+	if _, err := restarted.InitGenesis(other); err == nil {
+		t.Fatal("a different genesis should be refused")
+	}
+}
+
+func checkGenesisBlock(t *testing.T, s *State, genesis *GenesisBlock) {
+	block, err := s.GetBlockById(0)
+	if err != nil {
+		t.Fatal("genesis should be stored as block 0")
+	}
+	if len(block.Transactions()) != 0 || block.GetCreatedTime() != int64(genesis.Timestamp) {
+		t.Fatal("block 0 should have no transactions and the genesis timestamp")
+	}
+	if root, err := s.GetBlockRoot(0); err != nil || root != genesis.Root {
+		t.Fatal("genesis root should be recorded for block 0")
+	}
+}
+
+func TestLachesisBlocks(t *testing.T) {
+	removeChainData(t)
+	defer removeChainData(t)
+
+	test := NewTest("test_data/eth", LevelDBBackend, bcommon.NewTestLogger(t), t)
+	defer test.state.db.Close()
+
+	if err := test.Init(); err != nil {
+		t.Fatal(err)
+	}
+	genesisRoot := test.state.GetRoot()
+
+	from := test.keyStore.Accounts()[0]
+	to := test.keyStore.Accounts()[1]
+	tx, err := test.prepareTransaction(&from, &to, big.NewInt(1000), 21000, _defaultGasPrice, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Lachesis numbers its blocks from 0
+	block := poset.NewBlock(0, 1, nil, [][]byte{data})
+	root, err := test.state.ProcessLachesisBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Index() != 0 {
+		t.Fatal("the block committed by Lachesis should not be modified")
+	}
+	if root == genesisRoot || test.state.GetBlockIndex() != 1 {
+		t.Fatalf("Lachesis block 0 should be processed as block 1, not %d", test.state.GetBlockIndex())
+	}
+	if recorded, err := test.state.GetBlockRoot(0); err != nil || recorded != genesisRoot {
+		t.Fatal("block 0 should remain the genesis")
+	}
+
+	//the time set by the local clock of Lachesis is replaced by one derived
+	//from the round received
+	genesisBlock, err := test.state.GetBlockById(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := test.state.GetBlockById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.GetCreatedTime() != genesisBlock.GetCreatedTime()+1 {
+		t.Fatalf("Lachesis block should be one round after the genesis, not %d", processed.GetCreatedTime()-genesisBlock.GetCreatedTime())
+	}
+
+	snapshot, err := test.state.GetLachesisSnapshot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sn Snapshot
+	if err := sn.Unmarshal(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if sn.BlockIndex != 1 || sn.Root != root {
+		t.Fatalf("snapshot of Lachesis block 0 should be taken after block 1, not %d", sn.BlockIndex)
+	}
+
+	//a Lachesis node bootstrapped from its store replays committed blocks
+	balance := test.state.GetBalance(to.Address)
+	replayed, err := test.state.ProcessLachesisBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != root || test.state.GetBlockIndex() != 1 {
+		t.Fatal("a replayed block should give its recorded root")
+	}
+	if test.state.GetBalance(to.Address).Cmp(balance) != 0 {
+		t.Fatal("a replayed block should not be applied again")
+	}
+}
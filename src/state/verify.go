@@ -0,0 +1,240 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethState "github.com/ethereum/go-ethereum/core/state"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Fantom-foundation/go-lachesis/src/poset"
+)
+
+// VerifyReport is the outcome of a database verification. Problems lists the
+// inconsistencies which were found; the database is sound if it is empty.
+type VerifyReport struct {
+	Head         int64       `json:"head"`
+	Root         common.Hash `json:"root"`
+	Nodes        int         `json:"nodes"`
+	Blocks       int         `json:"blocks"`
+	Transactions int         `json:"transactions"`
+	Reexecuted   int         `json:"reexecuted"`
+	Problems     []string    `json:"problems"`
+}
+
+func (r *VerifyReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Err returns an error summing up the problems of the report, if any
+func (r *VerifyReport) Err() error {
+	switch len(r.Problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("database verification failed: %s", r.Problems[0])
+	default:
+		return fmt.Errorf("database verification failed: %s (and %d more problems)",
+			r.Problems[0], len(r.Problems)-1)
+	}
+}
+
+//Verify checks the integrity of the database: it walks the head state to make
+//sure that all its trie nodes and codes are present, and checks that every
+//block has its hash lookup entry and state root, and that every transaction
+//has its entry and a receipt. If reexecute is set, blocks are also executed
+//again from the genesis file, in a separate in-memory State, and the resulting
+//state roots are compared with the recorded ones. Chains which were modified
+//in dev mode can't be re-executed.
+func (s *State) Verify(reexecute bool, genesisFile string) (*VerifyReport, error) {
+	s.commitMutex.Lock()
+	defer s.commitMutex.Unlock()
+
+	report := &VerifyReport{
+		Head: s.blockIndex,
+		Root: s.GetRoot(),
+	}
+
+	if blockIndex, root, ok := s.lastCommit(); ok {
+		if blockIndex != report.Head || root != report.Root {
+			report.problem("head %d (root %s) does not match the last commit %d (root %s)",
+				report.Head, report.Root.Hex(), blockIndex, root.Hex())
+		}
+	}
+
+	s.verifyState(report)
+	s.verifyBlocks(report)
+
+	if reexecute {
+		if err := s.reexecute(report, genesisFile); err != nil {
+			return report, err
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"head":         report.Head,
+		"nodes":        report.Nodes,
+		"blocks":       report.Blocks,
+		"transactions": report.Transactions,
+		"reexecuted":   report.Reexecuted,
+		"problems":     len(report.Problems),
+	}).Info("Verified database")
+
+	return report, nil
+}
+
+//CheckIntegrity verifies the head state and the indexes, without re-executing
+//blocks, and returns an error if the database is inconsistent. It is meant to
+//run at startup.
+func (s *State) CheckIntegrity() error {
+	report, err := s.Verify(false, "")
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+//verifyState walks all the nodes and codes of the head state. Resolving a node
+//fails if it is missing from the database, which ends the walk.
+func (s *State) verifyState(report *VerifyReport) {
+	statedb, err := ethState.New(report.Root, s.ethState.Database())
+	if err != nil {
+		report.problem("head root %s: %v", report.Root.Hex(), err)
+		return
+	}
+	it := ethState.NewNodeIterator(statedb)
+	for it.Next() {
+		if it.Hash != (common.Hash{}) {
+			report.Nodes++
+		}
+	}
+	if it.Error != nil {
+		report.problem("head state %s: %v", report.Root.Hex(), it.Error)
+	}
+}
+
+//verifyBlocks checks the entries of the blocks up to the head
+func (s *State) verifyBlocks(report *VerifyReport) {
+	//every block must be stored, from the genesis, except those skipped by a
+	//snapshot restore
+	restored, _ := s.restoredBlock()
+
+	for index := int64(0); index <= report.Head; index++ {
+		data, err := s.db.Get(blockKey(index))
+		if err != nil {
+			if index == 0 || index >= restored {
+				report.problem("block %d: missing", index)
+			}
+			continue
+		}
+		report.Blocks++
+
+		block := new(poset.Block)
+		if err := block.ProtoUnmarshal(data); err != nil {
+			report.problem("block %d: %v", index, err)
+			continue
+		}
+		if block.Index() != index {
+			report.problem("block %d: stored under index %d", block.Index(), index)
+		}
+		hash, err := block.BlockHash()
+		if err != nil {
+			report.problem("block %d: %v", index, err)
+		} else if byHash, err := s.db.Get(hash); err != nil || !bytes.Equal(byHash, data) {
+			report.problem("block %d: missing or different hash lookup entry", index)
+		}
+		if _, err := s.GetBlockRoot(index); err != nil {
+			report.problem("block %d: no state root recorded", index)
+		}
+
+		for i, txBytes := range block.Transactions() {
+			var t ethTypes.Transaction
+			if err := rlp.DecodeBytes(txBytes, &t); err != nil {
+				//invalid transactions are only recorded in the block
+				continue
+			}
+			report.Transactions++
+			s.verifyTransaction(report, index, i, t.Hash())
+		}
+	}
+}
+
+//verifyTransaction checks that a transaction of a block has its entry and a
+//receipt
+func (s *State) verifyTransaction(report *VerifyReport, blockIndex int64, txIndex int, txHash common.Hash) {
+	if ok, _ := s.db.Has(txHash.Bytes()); !ok {
+		report.problem("block %d, tx %d (%s): missing transaction entry", blockIndex, txIndex, txHash.Hex())
+	}
+	data, err := s.db.Get(append(receiptsPrefix, txHash[:]...))
+	if err != nil {
+		report.problem("block %d, tx %d (%s): missing receipt", blockIndex, txIndex, txHash.Hex())
+		return
+	}
+	var receipt ethTypes.ReceiptForStorage
+	if err := rlp.DecodeBytes(data, &receipt); err != nil {
+		report.problem("block %d, tx %d (%s): invalid receipt: %v", blockIndex, txIndex, txHash.Hex(), err)
+		return
+	}
+	if receipt.TxHash != txHash {
+		report.problem("block %d, tx %d (%s): receipt of %s", blockIndex, txIndex, txHash.Hex(), receipt.TxHash.Hex())
+	}
+}
+
+//reexecute processes the blocks again, from the genesis file, in an in-memory
+//State, and compares the resulting roots with the recorded ones. It stops at
+//the first mismatch, as all later roots would differ too.
+func (s *State) reexecute(report *VerifyReport, genesisFile string) error {
+	replay, err := NewState(s.logger, ethdb.NewMemDatabase(), false, false)
+	if err != nil {
+		return err
+	}
+	defer replay.Close()
+
+	genesis, err := LoadGenesis(genesisFile)
+	if err != nil {
+		return err
+	}
+	hash, err := replay.InitGenesis(genesis)
+	if err != nil {
+		return err
+	}
+	if stored, err := s.db.Get(genesisHashKey); err == nil && common.BytesToHash(stored) != hash {
+		report.problem("genesis file gives genesis %s, not the recorded %s",
+			hash.Hex(), common.BytesToHash(stored).Hex())
+		return nil
+	}
+
+	//block 0 is the genesis, which the replay was initialised with
+	for index := int64(1); index <= report.Head; index++ {
+		data, err := s.db.Get(blockKey(index))
+		if err != nil {
+			continue
+		}
+		block := new(poset.Block)
+		if err := block.ProtoUnmarshal(data); err != nil {
+			continue
+		}
+
+		root, err := replay.ProcessBlock(*block)
+		if err != nil {
+			return err
+		}
+		report.Reexecuted++
+
+		recorded, err := s.GetBlockRoot(index)
+		if err != nil {
+			continue
+		}
+		if root != recorded {
+			report.problem("block %d: re-executed root %s does not match recorded root %s",
+				index, root.Hex(), recorded.Hex())
+			break
+		}
+	}
+
+	return nil
+}
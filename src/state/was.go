@@ -1,14 +1,11 @@
 package state
 
 import (
-	"math/big"
-
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	ethState "github.com/ethereum/go-ethereum/core/state"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -30,8 +27,9 @@ type WriteAheadState struct {
 	transactions []*ethTypes.Transaction
 	receipts     []*ethTypes.Receipt
 	allLogs      []*ethTypes.Log
+	txErrors     []TxError
 
-	totalUsedGas *big.Int
+	totalUsedGas uint64
 	gp           *core.GasPool
 
 	logger *logrus.Logger
@@ -72,79 +70,25 @@ func (was *WriteAheadState) Reset(root common.Hash) error {
 	was.transactions = []*ethTypes.Transaction{}
 	was.receipts = []*ethTypes.Receipt{}
 	was.allLogs = []*ethTypes.Log{}
+	was.txErrors = []TxError{}
 
-	was.totalUsedGas = new(big.Int).SetUint64(0)
+	was.totalUsedGas = 0
 	was.gp = new(core.GasPool).AddGas(was.gasLimit)
 
 	was.logger.WithFields(logrus.Fields{
-		"gasLimit": gasLimit,
+		"gasLimit": was.gasLimit,
 		"was.gp":   was.gp,
 	}).Debug("(was *WriteAheadState) Reset(root common.Hash)")
 
 	return nil
 }
 
-func (was *WriteAheadState) ApplyTransaction(tx ethTypes.Transaction, txIndex int, blockHash common.Hash) error {
-
-	msg, err := tx.AsMessage(was.signer)
-	if err != nil {
-		was.logger.WithError(err).Error("Converting Transaction to Message")
-		return err
-	}
-
-	context := vm.Context{
-		CanTransfer: core.CanTransfer,
-		Transfer:    core.Transfer,
-		GetHash:     func(uint64) common.Hash { return blockHash },
-		Origin:      msg.From(),
-		GasLimit:    msg.Gas(),
-		GasPrice:    msg.GasPrice(),
-		BlockNumber: big.NewInt(0), // The vm has a dependency on this..
-	}
-	was.logger.WithFields(logrus.Fields{
-		"GasLimit": msg.Gas()}).Debug("was.ApplyTransaction")
-
-	//Prepare the ethState with transaction Hash so that it can be used in emitted
-	//logs
-	was.ethState.Prepare(tx.Hash(), blockHash, txIndex)
-
-	vmenv := vm.NewEVM(context, was.ethState, &was.chainConfig, was.vmConfig)
-
-	// Apply the transaction to the current state (included in the env)
-	_, gas, failed, err := core.ApplyMessage(vmenv, msg, was.gp)
-	if err != nil {
-		was.logger.WithError(err).Error("Applying transaction to WriteAheadState")
-		return err
-	}
-
-	was.totalUsedGas.Add(was.totalUsedGas, new(big.Int).SetUint64(gas))
-
-	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
-	// based on the eip phase, we're passing whether the root touch-delete accounts.
-	root := was.ethState.IntermediateRoot(true) //this has side effects. It updates StateObjects (SmartContract memory)
-	receipt := ethTypes.NewReceipt(root.Bytes(), failed, was.totalUsedGas.Uint64())
-	receipt.TxHash = tx.Hash()
-	receipt.GasUsed = gas
-	// if the transaction created a contract, store the creation address in the receipt.
-	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
-	}
-	// Set the receipt logs and create a bloom for filtering
-	receipt.Logs = was.ethState.GetLogs(tx.Hash())
-	//receipt.Logs = s.was.state.Logs()
-	receipt.Bloom = ethTypes.CreateBloom(ethTypes.Receipts{receipt})
-
-	was.txIndex++
-	was.transactions = append(was.transactions, &tx)
-	was.receipts = append(was.receipts, receipt)
-	was.allLogs = append(was.allLogs, receipt.Logs...)
-
-	was.logger.WithField("hash", tx.Hash().Hex()).Debug("Applied tx to WAS")
-
-	return nil
-}
-
-func (was *WriteAheadState) Commit() (common.Hash, error) {
+//Commit writes the state changes to the trie database, and adds the
+//transactions, receipts, errors and preimages to batch, which the caller writes.
+//The trie is only written to disk if flush is set; otherwise it stays in the
+//cache of the trie database, which is how pruned mode avoids persisting every
+//intermediate state.
+func (was *WriteAheadState) Commit(batch ethdb.Batch, flush bool) (common.Hash, error) {
 	//commit all state changes to the database
 	root, err := was.ethState.Commit(true)
 	if err != nil {
@@ -152,46 +96,61 @@ func (was *WriteAheadState) Commit() (common.Hash, error) {
 		return common.Hash{}, err
 	}
 
-	//XXX FORCE DISK WRITE
-	// Apparently Geth does something smarter here... but can't figure it out
-	if err := was.ethState.Database().TrieDB().Commit(root, true); err != nil {
-		was.logger.WithError(err).Error("Writing root")
-		return common.Hash{}, err
+	//tries are content addressed, so writing them before the batch can only
+	//leave unreferenced nodes behind
+	if flush {
+		if err := was.ethState.Database().TrieDB().Commit(root, true); err != nil {
+			was.logger.WithError(err).Error("Writing root")
+			return common.Hash{}, err
+		}
 	}
-	if err := was.writeRoot(root); err != nil {
-		was.logger.WithError(err).Error("Writing root")
+	if err := was.writePreimages(batch); err != nil {
+		was.logger.WithError(err).Error("Writing preimages")
 		return common.Hash{}, err
 	}
-	if err := was.writeHead(); err != nil {
+	if err := was.writeHead(batch); err != nil {
 		was.logger.WithError(err).Error("Writing head")
 		return common.Hash{}, err
 	}
-	if err := was.writeTransactions(); err != nil {
+	if err := was.writeTransactions(batch); err != nil {
 		was.logger.WithError(err).Error("Writing txs")
 		return common.Hash{}, err
 	}
-	if err := was.writeReceipts(); err != nil {
+	if err := was.writeReceipts(batch); err != nil {
 		was.logger.WithError(err).Error("Writing receipts")
 		return common.Hash{}, err
 	}
+	if err := was.writeTxErrors(batch); err != nil {
+		was.logger.WithError(err).Error("Writing tx errors")
+		return common.Hash{}, err
+	}
 	return root, nil
 }
 
-func (was *WriteAheadState) writeRoot(root common.Hash) error {
-	return was.db.Put(rootKey, root.Bytes())
+//writePreimages persists the preimages of the hashes computed by the EVM, if
+//preimage recording is enabled
+func (was *WriteAheadState) writePreimages(batch ethdb.Putter) error {
+	if !was.vmConfig.EnablePreimageRecording {
+		return nil
+	}
+
+	for hash, preimage := range was.ethState.Preimages() {
+		if err := batch.Put(preimageKey(hash), preimage); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (was *WriteAheadState) writeHead() error {
+func (was *WriteAheadState) writeHead(batch ethdb.Putter) error {
 	head := &ethTypes.Transaction{}
 	if len(was.transactions) > 0 {
 		head = was.transactions[len(was.transactions)-1]
 	}
-	return was.db.Put(headTxKey, head.Hash().Bytes())
+	return batch.Put(headTxKey, head.Hash().Bytes())
 }
 
-func (was *WriteAheadState) writeTransactions() error {
-	batch := was.db.NewBatch()
-
+func (was *WriteAheadState) writeTransactions(batch ethdb.Putter) error {
 	for _, tx := range was.transactions {
 		data, err := rlp.EncodeToBytes(tx)
 		if err != nil {
@@ -201,14 +160,10 @@ func (was *WriteAheadState) writeTransactions() error {
 			return err
 		}
 	}
-
-	// Write the scheduled data into the database
-	return batch.Write()
+	return nil
 }
 
-func (was *WriteAheadState) writeReceipts() error {
-	batch := was.db.NewBatch()
-
+func (was *WriteAheadState) writeReceipts(batch ethdb.Putter) error {
 	for _, receipt := range was.receipts {
 		storageReceipt := (*ethTypes.ReceiptForStorage)(receipt)
 		data, err := rlp.EncodeToBytes(storageReceipt)
@@ -219,6 +174,20 @@ func (was *WriteAheadState) writeReceipts() error {
 			return err
 		}
 	}
+	return nil
+}
 
-	return batch.Write()
+//writeTxErrors records the reasons why transactions could not be applied
+func (was *WriteAheadState) writeTxErrors(batch ethdb.Putter) error {
+	for _, txError := range was.txErrors {
+		data, err := txError.Marshal()
+		if err != nil {
+			return err
+		}
+		txHash := txError.Tx.Hash()
+		if err := batch.Put(append(errorPrefix, txHash[:]...), data); err != nil {
+			return err
+		}
+	}
+	return nil
 }